@@ -0,0 +1,137 @@
+package exchange
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+// ErrNoIngestion is returned by the adapters whose archives are split per asset by the archiver.
+var ErrNoIngestion = errors.New("the archives of this exchange are written by the archiver")
+
+/*
+splitArchive writes the archive of each asset of the archive tree for the given date, from the raw archive at zipPath.
+The archives of the assets hold a <date>.csv file of "time,value" lines, the format read by the parsing.
+*/
+func splitArchive(zipPath string, archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) error {
+	tree, ok := ArchiveTree(archiveType)
+	if !ok {
+		return fmt.Errorf("archive %s not supported", archiveType)
+	}
+
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	archiveFile, found := lo.Find(r.File, func(f *zip.File) bool {
+		return strings.HasSuffix(f.Name, ".csv")
+	})
+	if !found {
+		return fmt.Errorf("no CSV file in %s", zipPath)
+	}
+	rc, err := archiveFile.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmpDir, err := os.MkdirTemp("", "split-"+date+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := make([]*os.File, len(tree.Columns))
+	writers := make([]*bufio.Writer, len(tree.Columns))
+	for i, column := range tree.Columns {
+		if err := os.MkdirAll(filepath.Join(tmpDir, string(column.Asset)), 0755); err != nil {
+			return err
+		}
+		if files[i], err = os.Create(filepath.Join(tmpDir, string(column.Asset), date+".csv")); err != nil {
+			return err
+		}
+		defer files[i].Close()
+		writers[i] = bufio.NewWriter(files[i])
+	}
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	header := map[string]int{}
+	for first := true; ; first = false {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first && lo.Contains(line, tree.Time.OriginColumnTitle) {
+			for i, title := range line {
+				header[title] = i
+			}
+			continue
+		}
+
+		t, err := branchValue(tree.Time, line, header)
+		if err != nil {
+			return err
+		}
+		for i, column := range tree.Columns {
+			value, err := branchValue(column, line, header)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				continue
+			}
+			if _, err := writers[i].WriteString(t + "," + value + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, column := range tree.Columns {
+		if err := writers[i].Flush(); err != nil {
+			return err
+		}
+		if err := files[i].Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+		if err := zipAssetArchive(files[i].Name(), settings.BuildArchiveFilePath(column.Asset, date, "zip")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func branchValue(branch pcommon.AssetBranch, line []string, header map[string]int) (string, error) {
+	if branch.OriginColumnIndex >= len(line) {
+		return "", fmt.Errorf("missing column %s", branch.OriginColumnTitle)
+	}
+	value := line[branch.OriginColumnIndex]
+	if branch.DataFilter != nil {
+		return branch.DataFilter(value, line, header)
+	}
+	return value, nil
+}
+
+// zipAssetArchive zips the CSV file of an asset next to its final path, then moves it there so the parsing never reads a partial archive.
+func zipAssetArchive(csvPath string, zipPath string) error {
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0755); err != nil {
+		return err
+	}
+	if err := pcommon.File.ZipFile(csvPath, zipPath+".tmp"); err != nil {
+		return err
+	}
+	return os.Rename(zipPath+".tmp", zipPath)
+}
@@ -0,0 +1,41 @@
+package exchange
+
+import (
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+// the archive trees unknown to the common library, whose lists are left untouched
+var localArchives = map[pcommon.ArchiveType]*pcommon.ArchiveDataTree{}
+
+// RegisterArchive adds an archive tree unknown to the common library, its archives being written by the adapters through FetchArchive.
+func RegisterArchive(archiveType pcommon.ArchiveType, tree *pcommon.ArchiveDataTree) {
+	localArchives[archiveType] = tree
+}
+
+// IsLocalArchive returns true if the archive was added by RegisterArchive.
+func IsLocalArchive(archiveType pcommon.ArchiveType) bool {
+	_, ok := localArchives[archiveType]
+	return ok
+}
+
+// ArchiveTree returns the tree of an archive of the common library or added by RegisterArchive.
+func ArchiveTree(archiveType pcommon.ArchiveType) (*pcommon.ArchiveDataTree, bool) {
+	if tree, ok := localArchives[archiveType]; ok {
+		return tree, true
+	}
+	tree, ok := pcommon.ArchivesIndex[archiveType]
+	return tree, ok
+}
+
+// ArchiveOf returns the archive an asset is parsed from, nil if it is not parsed from an archive.
+func ArchiveOf(assetType pcommon.AssetType) *pcommon.ArchiveType {
+	for archiveType, tree := range localArchives {
+		if lo.ContainsBy(tree.Columns, func(branch pcommon.AssetBranch) bool {
+			return branch.Asset == assetType
+		}) {
+			return &archiveType
+		}
+	}
+	return assetType.GetRequiredArchiveType()
+}
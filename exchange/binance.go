@@ -0,0 +1,276 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+const BINANCE = "binance"
+
+// BINANCE_BOOK_TICKER is unknown to the common library, its archives are downloaded and split per asset by FetchArchive.
+const BINANCE_BOOK_TICKER pcommon.ArchiveType = "binance_book_ticker"
+
+var BINANCE_QUOTES = []string{"USDT", "USDC"}
+
+// path of the daily archives on data.binance.vision and name of the file (between the symbol and the date)
+var binanceArchivePaths = map[pcommon.ArchiveType][2]string{
+	pcommon.BINANCE_SPOT_TRADES:    {"spot/daily/trades", "trades"},
+	pcommon.BINANCE_FUTURES_TRADES: {"futures/um/daily/trades", "trades"},
+	pcommon.BINANCE_BOOK_DEPTH:     {"futures/um/daily/bookDepth", "bookDepth"},
+	pcommon.BINANCE_METRICS:        {"futures/um/daily/metrics", "metrics"},
+	BINANCE_BOOK_TICKER:            {"futures/um/daily/bookTicker", "bookTicker"},
+}
+
+type binance struct{}
+
+type tickerPriceResponse struct {
+	Symbol string `json:"symbol"`
+	Price  string `json:"price"`
+}
+
+func getPairPrice(pair string, futures bool) (float64, error) {
+	var url string
+	if futures {
+		url = fmt.Sprintf("https://fapi.binance.com/fapi/v1/ticker/price?symbol=%s", pair)
+	} else {
+		url = fmt.Sprintf("https://api.binance.com/api/v3/ticker/price?symbol=%s", pair)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch pair price: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 400 || resp.StatusCode == 404 {
+		return 0, fmt.Errorf("pair %s not found", pair)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var priceResponse tickerPriceResponse
+	err = json.NewDecoder(resp.Body).Decode(&priceResponse)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	if priceResponse.Price == "" {
+		return 0, fmt.Errorf("internal error")
+	}
+
+	return strconv.ParseFloat(priceResponse.Price, 64)
+}
+
+type exchangeInfoResponse struct {
+	Symbols []symbolInfo `json:"symbols"`
+}
+
+type symbolInfo struct {
+	Symbol     string `json:"symbol"`
+	BaseAsset  string `json:"baseAsset"`
+	QuoteAsset string `json:"quoteAsset"`
+}
+
+// getSymbolInfo returns the base and quote assets of a symbol listed on the spot or the futures market.
+func getSymbolInfo(pair string, futures bool) (*symbolInfo, error) {
+	var url string
+	if futures {
+		// the futures endpoint does not filter by symbol
+		url = "https://fapi.binance.com/fapi/v1/exchangeInfo"
+	} else {
+		url = fmt.Sprintf("https://api.binance.com/api/v3/exchangeInfo?symbol=%s", pair)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 400 || resp.StatusCode == 404 {
+		return nil, fmt.Errorf("pair %s not found", pair)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var info exchangeInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	symbol, found := lo.Find(info.Symbols, func(s symbolInfo) bool {
+		return s.Symbol == pair
+	})
+	if !found {
+		return nil, fmt.Errorf("pair %s not found", pair)
+	}
+	return &symbol, nil
+}
+
+func (b *binance) Name() string {
+	return BINANCE
+}
+
+func (b *binance) SetType() pcommon.SetType {
+	return pcommon.BINANCE_PAIR
+}
+
+func (b *binance) ValidateSymbol(base string, quote string) error {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	if !lo.Contains(BINANCE_QUOTES, quote) {
+		return fmt.Errorf("unsupported quote %s", quote)
+	}
+
+	var lastErr error
+	for _, futures := range []bool{false, true} {
+		symbol, err := getSymbolInfo(base+quote, futures)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if symbol.BaseAsset == base && symbol.QuoteAsset == quote {
+			return nil
+		}
+		lastErr = fmt.Errorf("pair %s%s not found", base, quote)
+	}
+	return lastErr
+}
+
+func (b *binance) ValidateSettings(settings pcommon.SetSettings) error {
+	return settings.IsBinancePair()
+}
+
+func (b *binance) GetUSDPrice(symbol string) (float64, error) {
+	symbol = strings.ToUpper(symbol)
+	if strings.Contains(symbol, "USD") {
+		return 1.00, nil
+	}
+	price, err := getPairPrice(symbol+"USDT", true)
+	if err != nil {
+		return 0, err
+	}
+	if price == 0.00 {
+		return 0, errors.New("price is 0")
+	}
+	return price, nil
+}
+
+func (b *binance) GetArchiveURL(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) (string, error) {
+	path, ok := binanceArchivePaths[archiveType]
+	if !ok {
+		return "", fmt.Errorf("archive %s not available on binance", archiveType)
+	}
+	symbol := strings.ToUpper(settings.IDString())
+	fileName := fmt.Sprintf("%s-%s-%s.zip", symbol, path[1], date)
+	return fmt.Sprintf("https://data.binance.vision/data/%s/%s/%s", path[0], symbol, fileName), nil
+}
+
+// FetchArchive downloads and splits the archives unknown to the common library, the others being written by the archiver.
+func (b *binance) FetchArchive(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) error {
+	if !IsLocalArchive(archiveType) {
+		return ErrNoIngestion
+	}
+	url, err := b.GetArchiveURL(archiveType, date, settings)
+	if err != nil {
+		return err
+	}
+	zipPath, err := downloadArchive(url)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipPath)
+	return splitArchive(zipPath, archiveType, date, settings)
+}
+
+// downloadArchive writes the archive at url in a temporary file and returns its path.
+func downloadArchive(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("archive %s not found", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	file, err := os.CreateTemp("", "archive-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func (b *binance) FindMinHistoricalDay(archiveType pcommon.ArchiveType, minDateEver string, settings pcommon.SetSettings) (string, error) {
+	// Set the initial dates
+	startDate, err := pcommon.Format.StrDateToDate(minDateEver)
+	if err != nil {
+		return "", err
+	}
+
+	endDate := time.Now()
+
+	// Initialize the result with an empty string
+	var result string
+
+	for startDate.Before(endDate) {
+		midDate := startDate.Add(endDate.Sub(startDate) / 2)
+		if pcommon.Format.FormatDateStr(midDate) == result {
+			return result, nil
+		}
+
+		url, err := b.GetArchiveURL(archiveType, pcommon.Format.FormatDateStr(midDate), settings)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := http.Head(url) // Perform a HEAD request
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close() // Ensure we close the response body
+
+		log.WithFields(log.Fields{
+			"set_id":  strings.Join(settings.ID, ""),
+			"archive": archiveType,
+			"date":    pcommon.Format.FormatDateStr(midDate),
+			"status":  resp.Status,
+		}).Info("checking date...")
+
+		if resp.StatusCode == 200 {
+			// If the URL exists, it means data is available from this date
+			result = pcommon.Format.FormatDateStr(midDate)
+			endDate = midDate
+		} else {
+			// If the URL does not exist, search later dates
+			startDate = midDate.Add(time.Hour * 24)
+		}
+
+		time.Sleep(time.Millisecond * 30)
+	}
+
+	if result == "" {
+		return "", fmt.Errorf("no data found")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package exchange
+
+import (
+	"fmt"
+	"sort"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// Adapter gives access to the market data of a venue.
+type Adapter interface {
+	// Name is also the key of the set settings enabling the adapter (eg: {"binance": 1})
+	Name() string
+
+	// SetType returns the set type known by the common library, or -1 if the venue has none.
+	SetType() pcommon.SetType
+
+	// ValidateSymbol returns an error if the pair is not traded on the venue.
+	ValidateSymbol(base string, quote string) error
+
+	// ValidateSettings returns an error if the assets of the set are not supported by the venue.
+	ValidateSettings(settings pcommon.SetSettings) error
+
+	// GetUSDPrice returns the current price in USD of a token.
+	GetUSDPrice(symbol string) (float64, error)
+
+	// GetArchiveURL returns the location of the archive of the given date.
+	GetArchiveURL(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) (string, error)
+
+	// FindMinHistoricalDay returns the earliest date with an archive available, formatted as "YYYY-MM-DD".
+	FindMinHistoricalDay(archiveType pcommon.ArchiveType, minDateEver string, settings pcommon.SetSettings) (string, error)
+
+	// FetchArchive writes the archives of the assets of the given archive type and date, or returns ErrNoIngestion.
+	FetchArchive(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) error
+}
+
+const DEFAULT_EXCHANGE = BINANCE
+
+var adapters = map[string]Adapter{}
+
+func Register(adapter Adapter) {
+	adapters[adapter.Name()] = adapter
+}
+
+func Get(name string) (Adapter, error) {
+	adapter, ok := adapters[name]
+	if !ok {
+		return nil, fmt.Errorf("exchange %s not supported", name)
+	}
+	return adapter, nil
+}
+
+func List() []string {
+	names := []string{}
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FromSettings returns the adapter enabled in the set settings.
+func FromSettings(settings pcommon.SetSettings) (Adapter, error) {
+	for _, name := range List() {
+		if settings.HasSettingValue(name) == 1 {
+			return adapters[name], nil
+		}
+	}
+	return nil, fmt.Errorf("no exchange set for %s", settings.IDString())
+}
+
+func init() {
+	Register(&binance{})
+	Register(&local{})
+}
@@ -0,0 +1,115 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+const LOCAL = "local"
+
+/*
+local serves the archives and prices stored in the LOCAL_EXCHANGE_DIR folder:
+  - <LOCAL_EXCHANGE_DIR>/prices.json: the USD price of each token, eg: {"BTC": 60000}
+  - <LOCAL_EXCHANGE_DIR>/<SET ID>/<archive type>/<YYYY-MM-DD>.zip: the daily archives, in the CSV format of the archive type
+
+The daily archives are split per asset when their parsing is requested.
+*/
+type local struct{}
+
+func localDir() string {
+	return os.Getenv("LOCAL_EXCHANGE_DIR")
+}
+
+func (l *local) archiveFolderPath(archiveType pcommon.ArchiveType, settings pcommon.SetSettings) string {
+	return filepath.Join(localDir(), strings.ToUpper(settings.IDString()), string(archiveType))
+}
+
+func (l *local) Name() string {
+	return LOCAL
+}
+
+func (l *local) SetType() pcommon.SetType {
+	return -1
+}
+
+func (l *local) ValidateSymbol(base string, quote string) error {
+	if localDir() == "" {
+		return fmt.Errorf("LOCAL_EXCHANGE_DIR is not set")
+	}
+	id := pcommon.SetSettings{ID: []string{strings.ToUpper(base), strings.ToUpper(quote)}}
+	if _, err := os.Stat(filepath.Join(localDir(), id.IDString())); err != nil {
+		return fmt.Errorf("pair %s not found", id.IDString())
+	}
+	return nil
+}
+
+func (l *local) ValidateSettings(settings pcommon.SetSettings) error {
+	for _, asset := range settings.Assets {
+		address := asset.Address.AddSetID(settings.ID)
+		if !address.HasArguments() && !address.HasDependencies() && ArchiveOf(address.AssetType) == nil {
+			return fmt.Errorf("unsupported asset")
+		}
+	}
+	return nil
+}
+
+func (l *local) GetUSDPrice(symbol string) (float64, error) {
+	symbol = strings.ToUpper(symbol)
+	if strings.Contains(symbol, "USD") {
+		return 1.00, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(localDir(), "prices.json"))
+	if err != nil {
+		return 0, err
+	}
+	prices := map[string]float64{}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return 0, fmt.Errorf("prices.json file is not a valid json file: %s", err)
+	}
+	price, ok := prices[symbol]
+	if !ok || price == 0.00 {
+		return 0, fmt.Errorf("no price found for %s", symbol)
+	}
+	return price, nil
+}
+
+func (l *local) GetArchiveURL(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) (string, error) {
+	return "file://" + filepath.Join(l.archiveFolderPath(archiveType, settings), date+".zip"), nil
+}
+
+func (l *local) FetchArchive(archiveType pcommon.ArchiveType, date string, settings pcommon.SetSettings) error {
+	return splitArchive(filepath.Join(l.archiveFolderPath(archiveType, settings), date+".zip"), archiveType, date, settings)
+}
+
+func (l *local) FindMinHistoricalDay(archiveType pcommon.ArchiveType, minDateEver string, settings pcommon.SetSettings) (string, error) {
+	entries, err := os.ReadDir(l.archiveFolderPath(archiveType, settings))
+	if err != nil {
+		return "", err
+	}
+
+	dates := []string{}
+	for _, entry := range entries {
+		date := strings.TrimSuffix(entry.Name(), ".zip")
+		if entry.IsDir() || date == entry.Name() {
+			continue
+		}
+		if _, err := pcommon.Format.StrDateToDate(date); err != nil {
+			continue
+		}
+		if strings.Compare(date, minDateEver) >= 0 {
+			dates = append(dates, date)
+		}
+	}
+	if len(dates) == 0 {
+		return "", fmt.Errorf("no data found")
+	}
+	sort.Strings(dates)
+	return dates[0], nil
+}
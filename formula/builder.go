@@ -0,0 +1,187 @@
+package formula
+
+import (
+	"encoding/json"
+	"math"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+// window is the rolling state of a function call with a window, persisted between two indexings.
+type window struct {
+	Values []float64 `json:"values"`
+	Sum    float64   `json:"sum"`
+	SumSq  float64   `json:"sum_sq"`
+}
+
+func (w *window) push(v float64, size int) {
+	w.Values = append(w.Values, v)
+	w.Sum += v
+	w.SumSq += v * v
+	if len(w.Values) > size {
+		w.Sum -= w.Values[0]
+		w.SumSq -= w.Values[0] * w.Values[0]
+		w.Values = w.Values[1:]
+	}
+}
+
+func (w *window) mean() float64 {
+	return w.Sum / float64(len(w.Values))
+}
+
+func (w *window) std() float64 {
+	mean := w.mean()
+	return math.Sqrt(math.Max(0, w.SumSq/float64(len(w.Values))-mean*mean))
+}
+
+/*
+Builder computes the points of a formula asset, tick by tick, from the aligned ticks of its dependencies.
+It has the same interface as the pendule-common indicator data builders.
+*/
+type Builder struct {
+	expression *Expression
+	windows    []window
+	precision  int8
+}
+
+func NewBuilder(expr string, depCount int, prevState []byte, precision int8) (*Builder, error) {
+	expression, err := Parse(expr, depCount, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &Builder{expression: expression, precision: precision}
+	if len(prevState) > 0 {
+		if err := json.Unmarshal(prevState, &b.windows); err != nil {
+			return nil, err
+		}
+	}
+	//the state doesn't match the expression (new asset or corrupted state)
+	if len(b.windows) != len(expression.windows) {
+		b.windows = make([]window, len(expression.windows))
+	}
+	return b, nil
+}
+
+func (b *Builder) PrevState() []byte {
+	state, _ := json.Marshal(b.windows)
+	return state
+}
+
+// ComputeUnsafe evaluates the expression on the given ticks, a tick without value (NaN, infinite) gives a nil point.
+func (b *Builder) ComputeUnsafe(dataList ...pcommon.Data) (*pcommon.Point, error) {
+	v, err := b.eval(b.expression.root, dataList)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, nil
+	}
+	if b.precision >= 0 {
+		v = pcommon.Math.RoundFloat(v, uint(b.precision))
+	}
+	return &pcommon.Point{Value: v}, nil
+}
+
+func defaultValue(data pcommon.Data) (float64, error) {
+	switch data.Type() {
+	case pcommon.UNIT:
+		return data.ValueAt(pcommon.ColumnType.CLOSE)
+	case pcommon.QUANTITY:
+		plus, err := data.ValueAt(pcommon.ColumnType.PLUS)
+		if err != nil {
+			return 0, err
+		}
+		minus, err := data.ValueAt(pcommon.ColumnType.MINUS)
+		return plus + minus, err
+	}
+	return data.ValueAt(pcommon.ColumnType.VALUE)
+}
+
+// eval evaluates every node, whatever the result of the others, so the rolling states move forward on each tick.
+func (b *Builder) eval(n *node, dataList []pcommon.Data) (float64, error) {
+	switch n.kind {
+	case NUMBER:
+		return n.value, nil
+	case DEPENDENCY:
+		if n.column == "" {
+			return defaultValue(dataList[n.dep])
+		}
+		return dataList[n.dep].ValueAt(n.column)
+	}
+
+	args := make([]float64, len(n.children))
+	for i, child := range n.children {
+		v, err := b.eval(child, dataList)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+
+	switch n.kind {
+	case UNARY:
+		return -args[0], nil
+	case BINARY:
+		switch n.op {
+		case '+':
+			return args[0] + args[1], nil
+		case '-':
+			return args[0] - args[1], nil
+		case '*':
+			return args[0] * args[1], nil
+		default:
+			if args[1] == 0 {
+				return math.NaN(), nil
+			}
+			return args[0] / args[1], nil
+		}
+	}
+
+	x := args[0]
+	switch n.function {
+	case "abs":
+		return math.Abs(x), nil
+	case "log":
+		return math.Log(x), nil
+	case "sqrt":
+		return math.Sqrt(x), nil
+	}
+
+	//ticks without value are not part of the rolling windows
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return math.NaN(), nil
+	}
+	w := &b.windows[n.id]
+	if n.function == "lag" {
+		//the window keeps the current value and the n previous ones
+		w.push(x, n.window+1)
+		if len(w.Values) <= n.window {
+			return math.NaN(), nil
+		}
+		return w.Values[0], nil
+	}
+
+	w.push(x, n.window)
+	if len(w.Values) < n.window {
+		return math.NaN(), nil
+	}
+	switch n.function {
+	case "mean":
+		return w.mean(), nil
+	case "std":
+		return w.std(), nil
+	case "sum":
+		return w.Sum, nil
+	case "min":
+		return lo.Min(w.Values), nil
+	case "max":
+		return lo.Max(w.Values), nil
+	}
+	//zscore
+	std := w.std()
+	if std == 0 {
+		return math.NaN(), nil
+	}
+	return (x - w.mean()) / std, nil
+}
@@ -0,0 +1,285 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+/*
+An expression combines the values of the dependencies of a formula asset, named A, B, C and D by their position.
+
+	A, B...               the default column of the dependency (close for units, plus + minus for quantities, value for points)
+	close(A), plus(B)...  a column of the dependency, without its underscores (absolutesum, plusaverage...)
+	+ - * / ( )           arithmetic operators, a division by zero gives no value
+	abs(x) log(x) sqrt(x)
+	lag(x, n)             the value of x n ticks ago
+	mean(x, n) std(x, n) sum(x, n) min(x, n) max(x, n) zscore(x, n)
+	                      rolling statistics over the last n ticks, no value until n ticks are known
+
+The ticks where x has no value are skipped by the rolling functions.
+
+Expressions are stored in the asset address, they can't contain the characters used by the address format.
+*/
+
+const MAX_WINDOW = 10_000
+
+const FORBIDDEN_CHARACTERS = "_;[]="
+
+var DEPENDENCY_NAMES = []string{"A", "B", "C", "D"}
+
+var unaryFunctions = []string{"abs", "log", "sqrt"}
+var windowFunctions = []string{"lag", "mean", "std", "sum", "min", "max", "zscore"}
+
+// columnFunctions maps the column names without their underscores to the columns of all the data types
+var columnFunctions = func() map[string]pcommon.ColumnName {
+	ret := map[string]pcommon.ColumnName{}
+	for _, dataType := range []pcommon.DataType{pcommon.UNIT, pcommon.QUANTITY, pcommon.POINT} {
+		for _, column := range dataType.Columns() {
+			if column != pcommon.ColumnType.TIME {
+				ret[strings.ReplaceAll(string(column), "_", "")] = column
+			}
+		}
+	}
+	return ret
+}()
+
+type nodeKind int8
+
+const (
+	NUMBER nodeKind = iota
+	DEPENDENCY
+	UNARY
+	BINARY
+	CALL
+)
+
+type node struct {
+	kind     nodeKind
+	value    float64            // NUMBER
+	dep      int                // DEPENDENCY
+	column   pcommon.ColumnName // DEPENDENCY, empty for the default column
+	op       byte               // UNARY, BINARY
+	function string             // CALL
+	window   int                // CALL with a window
+	id       int                // CALL with a window, index of its rolling state
+	children []*node
+}
+
+type Expression struct {
+	root    *node
+	windows []int // window size of each rolling state
+}
+
+type parser struct {
+	src     string
+	pos     int
+	depType []pcommon.DataType
+	windows []int
+}
+
+/*
+Parse compiles an expression over depCount dependencies.
+If depTypes is not nil, the columns read from each dependency are checked against its data type.
+*/
+func Parse(expr string, depCount int, depTypes []pcommon.DataType) (*Expression, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if i := strings.IndexAny(expr, FORBIDDEN_CHARACTERS); i >= 0 {
+		return nil, fmt.Errorf("character %q is not allowed in an expression", expr[i])
+	}
+	if depCount > len(DEPENDENCY_NAMES) {
+		return nil, fmt.Errorf("at most %d dependencies are supported", len(DEPENDENCY_NAMES))
+	}
+
+	p := &parser{src: expr, depType: depTypes}
+	root, err := p.parseExpr(depCount)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return &Expression{root: root, windows: p.windows}, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return p.errorf("expected %q at the end of the expression", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.src[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// expr := term (('+' | '-') term)*
+func (p *parser) parseExpr(depCount int) (*node, error) {
+	left, err := p.parseTerm(depCount)
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '+' || c == '-'; c = p.peek() {
+		p.pos++
+		right, err := p.parseTerm(depCount)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: BINARY, op: c, children: []*node{left, right}}
+	}
+	return left, nil
+}
+
+// term := unary (('*' | '/') unary)*
+func (p *parser) parseTerm(depCount int) (*node, error) {
+	left, err := p.parseUnary(depCount)
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '*' || c == '/'; c = p.peek() {
+		p.pos++
+		right, err := p.parseUnary(depCount)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{kind: BINARY, op: c, children: []*node{left, right}}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *parser) parseUnary(depCount int) (*node, error) {
+	if p.peek() == '-' {
+		p.pos++
+		child, err := p.parseUnary(depCount)
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: UNARY, op: '-', children: []*node{child}}, nil
+	}
+	return p.parsePrimary(depCount)
+}
+
+// primary := number | dependency | function '(' arguments ')' | '(' expr ')'
+func (p *parser) parsePrimary(depCount int) (*node, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end of the expression")
+	case c == '(':
+		p.pos++
+		n, err := p.parseExpr(depCount)
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(')')
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case unicode.IsLetter(rune(c)):
+		return p.parseIdentifier(depCount)
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *parser) parseNumber() (*node, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+	}
+	return &node{kind: NUMBER, value: v}, nil
+}
+
+func (p *parser) parseDependency(name string, depCount int, column pcommon.ColumnName) (*node, error) {
+	dep := lo.IndexOf(DEPENDENCY_NAMES, name)
+	if dep < 0 || dep >= depCount {
+		return nil, p.errorf("unknown dependency %s, expected one of %v", name, DEPENDENCY_NAMES[:depCount])
+	}
+	if column != "" && p.depType != nil && p.depType[dep] > 0 && !lo.Contains(p.depType[dep].Columns(), column) {
+		return nil, p.errorf("%s has no column %s", name, column)
+	}
+	return &node{kind: DEPENDENCY, dep: dep, column: column}, nil
+}
+
+func (p *parser) parseIdentifier(depCount int) (*node, error) {
+	start := p.pos
+	for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+
+	if p.peek() != '(' {
+		return p.parseDependency(name, depCount, "")
+	}
+	p.pos++
+
+	//column of a dependency
+	if column, ok := columnFunctions[name]; ok {
+		p.skipSpaces()
+		depStart := p.pos
+		for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		n, err := p.parseDependency(p.src[depStart:p.pos], depCount, column)
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(')')
+	}
+
+	if !lo.Contains(unaryFunctions, name) && !lo.Contains(windowFunctions, name) {
+		return nil, p.errorf("unknown function %s", name)
+	}
+
+	arg, err := p.parseExpr(depCount)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{kind: CALL, function: name, children: []*node{arg}}
+
+	if lo.Contains(windowFunctions, name) {
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		window, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if window.value != float64(int(window.value)) || window.value < 1 || window.value > MAX_WINDOW {
+			return nil, p.errorf("the window of %s must be an integer between 1 and %d", name, MAX_WINDOW)
+		}
+		n.window = int(window.value)
+		n.id = len(p.windows)
+		p.windows = append(p.windows, n.window)
+	}
+	return n, p.expect(')')
+}
@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"pendulev2/metrics"
 	"pendulev2/rpc"
+	"pendulev2/script"
 	manager "pendulev2/set-manager"
 	setlib "pendulev2/set2"
 	engine "pendulev2/task-engine"
@@ -33,16 +35,30 @@ var server *http.Server
 var wsConns sync.Map
 
 func main() {
-	initLogger()
+	if script.IsWorker() {
+		script.RunWorker()
+		return
+	}
+
 	pcommon.Env.Init()
+	if err := util.InitLogger(); err != nil {
+		log.Fatal(err)
+	}
 	log.Info("MIN_TIME_FRAME: ", pcommon.Env.MIN_TIME_FRAME)
-	engine.Engine.Init(&activeSets)
 
 	if os.Getenv("CSV_DIR") == "" {
 		log.Fatal("CSV_DIR is not set")
 	}
+	//the disk watchdog measures the data directories from the start, before anything is written to them
+	for _, dir := range util.DataDirs() {
+		if err := pcommon.File.EnsureDir(dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	engine.Engine.Init(&activeSets)
 
 	rpc.Init(&activeSets, manager.Init(&activeSets, os.Getenv("SETS_PATH")))
+	metrics.OnScrape(updateDBSizeMetrics)
 	go initWS()
 	go initScheduleAutoCSVDelete()
 
@@ -105,9 +121,11 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 	wsConns.Store(conn.RemoteAddr(), conn)
+	metrics.WebsocketConnections.Inc()
 
 	defer func() {
 		wsConns.Delete(conn.RemoteAddr())
+		metrics.WebsocketConnections.Dec()
 		conn.Close()
 	}()
 
@@ -117,7 +135,13 @@ func handler(w http.ResponseWriter, r *http.Request) {
 			log.Println("read:", err)
 			break
 		}
+		start := time.Now()
 		response := pcommon.RPC.HandleServerRequest(message, rpc.Service)
+		method := rpcMethod(message, response)
+		metrics.ObserveRPC(method, response.Error, time.Since(start))
+		if response.Error != "" {
+			util.RPCLog(method, "").WithField("error", response.Error).Debug("RPC failed")
+		}
 		jsonResponse, err := json.Marshal(response)
 		if err != nil {
 			log.Println("json:", err)
@@ -131,6 +155,15 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rpcMethod returns the method called by a message, the unknown methods being grouped so clients can't add labels at will.
+func rpcMethod(message []byte, response pcommon.RPCResponse) string {
+	action := pcommon.RPCAction{}
+	if json.Unmarshal(message, &action) != nil || response.Error == "method not found" {
+		return "unknown"
+	}
+	return action.Method
+}
+
 func initScheduleAutoCSVDelete() {
 	csvDIR := os.Getenv("CSV_DIR")
 
@@ -161,10 +194,62 @@ func initScheduleAutoCSVDelete() {
 	util.ScheduleTask(context.Background(), 3, 3, task)
 }
 
+func updateDBSizeMetrics() {
+	metrics.DBSize.Reset()
+	for _, set := range activeSets.Range() {
+		lsm, vlog := set.DBSize()
+		metrics.DBSize.WithLabelValues(set.ID(), "lsm").Set(float64(lsm))
+		metrics.DBSize.WithLabelValues(set.ID(), "vlog").Set(float64(vlog))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// healthzHandler answers 200 unless the engine is stalled: runners are running without progress.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	liveness := engine.Engine.Liveness()
+	status := http.StatusOK
+	if liveness.Stalled {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, liveness)
+}
+
+// readyzHandler answers 200 once the sets are loaded with their database open and the data directories are reachable.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	problems := []string{}
+	if rpc.Service == nil {
+		problems = append(problems, "sets not loaded")
+	}
+	for _, set := range activeSets.Range() {
+		if !set.IsOpen() {
+			problems = append(problems, fmt.Sprintf("database of set %s closed", set.ID()))
+		}
+	}
+	for _, dir := range util.DataDirs() {
+		if _, err := util.GetDiskSpace(dir); err != nil {
+			problems = append(problems, fmt.Sprintf("%s unreachable: %s", dir, err.Error()))
+		}
+	}
+
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"ready": false, "problems": problems})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ready": true})
+}
+
 func initWS() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handler)
 	mux.HandleFunc("/download/", fileDownloadHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
 
 	server = &http.Server{
 		Addr:    ":" + pcommon.Env.PARSER_SERVER_PORT,
@@ -177,22 +262,6 @@ func initWS() {
 	}
 }
 
-func initLogger() {
-	// Log as JSON instead of the default ASCII formatter.
-	log.SetFormatter(&log.TextFormatter{
-		ForceColors:      true,                  // Force colored log output even if stdout is not a tty.
-		FullTimestamp:    true,                  // Enable logging the full timestamp instead of just the time passed since application started.
-		TimestampFormat:  "2006-01-02 15:04:05", // Set the format for the timestamp.
-		DisableTimestamp: false,                 // Do not disable printing timestamps.
-	})
-
-	// Output to stdout instead of the default stderr, could also be a file.
-	log.SetOutput(os.Stdout)
-
-	// Only log the warning severity or above.
-	log.SetLevel(log.InfoLevel)
-}
-
 func fileDownloadHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	// Allow all origins
@@ -272,6 +341,7 @@ func fileDownloadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		totalBytesSent += int64(n)
+		metrics.DownloadBytesSent.Add(float64(n))
 	}
 	ticker.Stop()
 	close(done)
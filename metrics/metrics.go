@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+The metrics are exposed in the Prometheus format on /metrics.
+Counters and histograms are updated where the work is done, the gauges reading a state are refreshed by the functions
+registered with OnScrape before each scrape.
+*/
+
+const NAMESPACE = "pendule"
+
+var (
+	TicksParsed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "ticks_parsed_total",
+		Help:      "Lines parsed from the archives.",
+	}, []string{"set", "archive"})
+
+	RowsStored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "rows_stored_total",
+		Help:      "Rows stored in the databases.",
+	}, []string{"asset", "timeframe"})
+
+	CSVBytesWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "csv_bytes_written_total",
+		Help:      "Bytes written in the CSV exports.",
+	})
+
+	DownloadBytesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "download_bytes_sent_total",
+		Help:      "Bytes of the CSV exports sent to the clients.",
+	})
+
+	RunnerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "runner_duration_seconds",
+		Help:      "Duration of the runners, by kind and outcome.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"kind", "outcome"})
+
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "queue_depth",
+		Help:      "Runners in the job queue, by state.",
+	}, []string{"state"})
+
+	DBSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "db_size_bytes",
+		Help:      "Size of the database of the sets, by part (lsm or vlog).",
+	}, []string{"set", "part"})
+
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "rpc_duration_seconds",
+		Help:      "Duration of the RPC calls, by method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status"})
+
+	WebsocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		TicksParsed,
+		RowsStored,
+		CSVBytesWritten,
+		DownloadBytesSent,
+		RunnerDuration,
+		QueueDepth,
+		DBSize,
+		RPCDuration,
+		WebsocketConnections,
+	)
+}
+
+var scrapeHooks = []func(){}
+var scrapeMu sync.Mutex
+
+// OnScrape registers a function refreshing gauges before each scrape.
+func OnScrape(hook func()) {
+	scrapeMu.Lock()
+	defer scrapeMu.Unlock()
+	scrapeHooks = append(scrapeHooks, hook)
+}
+
+func Handler() http.Handler {
+	handler := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapeMu.Lock()
+		for _, hook := range scrapeHooks {
+			hook()
+		}
+		scrapeMu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ObserveRPC records the duration of an RPC call, failed if errStr is not empty.
+func ObserveRPC(method string, errStr string, duration time.Duration) {
+	status := "ok"
+	if errStr != "" {
+		status = "error"
+	}
+	RPCDuration.WithLabelValues(method, status).Observe(duration.Seconds())
+}
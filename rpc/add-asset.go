@@ -48,7 +48,7 @@ func (s *RPCService) AddAsset(payload pcommon.RPCRequestPayload) (*pcommon.SetJS
 				if s == nil {
 					return nil, fmt.Errorf("dependency not found")
 				}
-				asset := s.Assets[dep]
+				asset := s.Asset(dep)
 				if asset == nil {
 					return nil, fmt.Errorf("dependency not found")
 				}
@@ -76,6 +76,9 @@ func (s *RPCService) AddAsset(payload pcommon.RPCRequestPayload) (*pcommon.SetJS
 		}
 	}
 
+	if err := set.ValidateAssetRules(r.Asset); err != nil {
+		return nil, err
+	}
 	if err := set.AddAsset(r.Asset); err != nil {
 		return nil, err
 	}
@@ -1,13 +1,21 @@
 package rpc
 
 import (
+	"pendulev2/exchange"
+	setlib "pendulev2/set2"
 	"strings"
 
 	pcommon "github.com/pendulea/pendule-common"
 )
 
 type AddSetRequest struct {
-	Symbol string `json:"symbol"`
+	Symbol   string `json:"symbol"`
+	Quote    string `json:"quote"`
+	Exchange string `json:"exchange"`
+
+	//optional USD prices of the tokens, to create a set without network access
+	PriceA float64 `json:"price_a"`
+	PriceB float64 `json:"price_b"`
 }
 
 func (s *RPCService) AddSet(payload pcommon.RPCRequestPayload) (*pcommon.SetJSON, error) {
@@ -17,14 +25,40 @@ func (s *RPCService) AddSet(payload pcommon.RPCRequestPayload) (*pcommon.SetJSON
 		return nil, err
 	}
 
+	if r.Exchange == "" {
+		r.Exchange = exchange.DEFAULT_EXCHANGE
+	}
+	if r.Quote == "" {
+		r.Quote = "USDT"
+	}
+
+	adapter, err := exchange.Get(r.Exchange)
+	if err != nil {
+		return nil, err
+	}
+	if err := adapter.ValidateSymbol(r.Symbol, r.Quote); err != nil {
+		return nil, err
+	}
+
 	setSettings := pcommon.SetSettings{
 		Assets: []pcommon.AssetSettings{},
-		ID:     []string{strings.ToUpper(r.Symbol), "USDT"},
+		ID:     []string{strings.ToUpper(r.Symbol), strings.ToUpper(r.Quote)},
 		Settings: map[string]int64{
-			"binance": 1,
+			adapter.Name(): 1,
 		},
 	}
 
+	if r.PriceA > 0 {
+		if err := setlib.SetPriceSetting(&setSettings, setlib.PRICE_A_SETTING_KEY, r.PriceA); err != nil {
+			return nil, err
+		}
+	}
+	if r.PriceB > 0 {
+		if err := setlib.SetPriceSetting(&setSettings, setlib.PRICE_B_SETTING_KEY, r.PriceB); err != nil {
+			return nil, err
+		}
+	}
+
 	err = s.SM.Add(setSettings, true)
 	if err != nil {
 		return nil, err
@@ -11,6 +11,8 @@ type BuildCSVRequest struct {
 	Timeframe int64      `json:"timeframe"` //in milliseconds
 	From      int64      `json:"from"`
 	To        int64      `json:"to"`
+
+	Priority *engine.Priority `json:"priority"` //overrides the priority of the exports
 }
 
 func (s *RPCService) BuildCSV(payload pcommon.RPCRequestPayload) (interface{}, error) {
@@ -19,5 +21,5 @@ func (s *RPCService) BuildCSV(payload pcommon.RPCRequestPayload) (interface{}, e
 	if err != nil {
 		return nil, err
 	}
-	return nil, engine.Engine.AddCSVBuilding(r.From, r.To, r.Timeframe, r.Orders)
+	return nil, engine.Engine.AddCSVBuilding(r.From, r.To, r.Timeframe, r.Orders, r.Priority)
 }
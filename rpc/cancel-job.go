@@ -0,0 +1,16 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// CancelJob removes a job from the queue, a running job stops at its next safe point.
+func (s *RPCService) CancelJob(payload pcommon.RPCRequestPayload) (interface{}, error) {
+	r := JobRequest{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return nil, engine.Engine.CancelJob(r.ID)
+}
@@ -0,0 +1,21 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type ClearDayFailureRequest struct {
+	Address pcommon.AssetAddress `json:"address"`
+	Date    string               `json:"date"`
+}
+
+// ClearDayFailure lifts the quarantine or the backoff of a day of an asset, so it is parsed again right away.
+func (s *RPCService) ClearDayFailure(payload pcommon.RPCRequestPayload) (interface{}, error) {
+	r := ClearDayFailureRequest{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return nil, engine.Engine.ClearDayFailure(r.Address, r.Date)
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	setlib "pendulev2/set2"
+	engine "pendulev2/task-engine"
+	"time"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type DependencyGraphNode struct {
+	Address       pcommon.AssetAddress  `json:"address"`
+	SetID         string                `json:"set_id"`
+	Type          pcommon.AssetType     `json:"type"`
+	Consistencies []pcommon.Consistency `json:"consistencies"`
+}
+
+type GetDependencyGraphResponse struct {
+	Nodes []DependencyGraphNode   `json:"nodes"`
+	Edges []setlib.DependencyEdge `json:"edges"`
+}
+
+// AffectedAsset is an asset, and its timeframes in milliseconds, touched by a rollback or a removal.
+type AffectedAsset struct {
+	Address    pcommon.AssetAddress `json:"address"`
+	SetID      string               `json:"set_id"`
+	Timeframes []int64              `json:"timeframes"`
+}
+
+func newAffectedAsset(asset *setlib.AssetState, timeframes []time.Duration) AffectedAsset {
+	ret := AffectedAsset{
+		Address:    asset.Address(),
+		SetID:      asset.SetRef.Settings.IDString(),
+		Timeframes: []int64{},
+	}
+	for _, tf := range timeframes {
+		ret.Timeframes = append(ret.Timeframes, tf.Milliseconds())
+	}
+	return ret
+}
+
+// GetDependencyGraph returns the assets of all the sets with their consistencies, and the dependencies between them (from the dependency to the asset computed from it).
+func (s *RPCService) GetDependencyGraph(payload pcommon.RPCRequestPayload) (*GetDependencyGraphResponse, error) {
+	graph := s.Sets.DependencyGraph()
+
+	nodes := []DependencyGraphNode{}
+	for _, asset := range graph.Assets() {
+		assetJSON, err := asset.JSON()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, DependencyGraphNode{
+			Address:       asset.Address(),
+			SetID:         asset.SetRef.Settings.IDString(),
+			Type:          asset.Type(),
+			Consistencies: assetJSON.Consistencies,
+		})
+	}
+
+	return &GetDependencyGraphResponse{
+		Nodes: nodes,
+		Edges: graph.Edges(),
+	}, nil
+}
+
+func rollBackImpact(asset *setlib.AssetState, timeframe time.Duration) []AffectedAsset {
+	list := []AffectedAsset{}
+	for _, target := range engine.Engine.RollBackImpact(asset, timeframe) {
+		list = append(list, newAffectedAsset(target.Asset, target.Timeframes))
+	}
+	return list
+}
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	setlib "pendulev2/set2"
+	engine "pendulev2/task-engine"
+	"pendulev2/util"
+	"sort"
+	"time"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type AssetSyncLag struct {
+	Address         pcommon.AssetAddress `json:"address"`
+	ConsistencyTime int64                `json:"consistency_time"` //in milliseconds, 0 if nothing is stored yet
+	Lag             int64                `json:"lag"`              //in milliseconds, 0 if nothing is stored yet
+	Error           string               `json:"error,omitempty"`
+}
+
+type SetDiagnostics struct {
+	ID       string         `json:"id"`
+	DBOpen   bool           `json:"db_open"`
+	LSMSize  int64          `json:"lsm_size"`
+	VlogSize int64          `json:"vlog_size"`
+	Assets   []AssetSyncLag `json:"assets"`
+}
+
+type GetDiagnosticsResponse struct {
+	Sets   []SetDiagnostics      `json:"sets"`
+	Disks  []util.DiskSpace      `json:"disks"`
+	Engine engine.EngineLiveness `json:"engine"`
+}
+
+func diagnoseSet(set *setlib.Set) SetDiagnostics {
+	d := SetDiagnostics{ID: set.ID(), DBOpen: set.IsOpen(), Assets: []AssetSyncLag{}}
+	if !d.DBOpen {
+		return d
+	}
+	d.LSMSize, d.VlogSize = set.DBSize()
+
+	//the sync lag is the time between now and the last time of the minimum timeframe
+	for _, asset := range set.AssetList() {
+		lag := AssetSyncLag{Address: asset.Address()}
+		consistencyTime, err := asset.GetLastConsistencyTimeCached(pcommon.Env.MIN_TIME_FRAME)
+		if err != nil {
+			lag.Error = err.Error()
+		} else if consistencyTime > 0 {
+			lag.ConsistencyTime = consistencyTime.ToTime().UnixMilli()
+			lag.Lag = time.Since(consistencyTime.ToTime()).Milliseconds()
+		}
+		d.Assets = append(d.Assets, lag)
+	}
+	sort.Slice(d.Assets, func(i, j int) bool {
+		return d.Assets[i].Address < d.Assets[j].Address
+	})
+	return d
+}
+
+// GetDiagnostics reports the status of the databases, the free space of the data directories, the liveness of the engine and the sync lag of the assets.
+func (s *RPCService) GetDiagnostics(payload pcommon.RPCRequestPayload) (*GetDiagnosticsResponse, error) {
+	r := &GetDiagnosticsResponse{
+		Sets:   []SetDiagnostics{},
+		Disks:  []util.DiskSpace{},
+		Engine: engine.Engine.Liveness(),
+	}
+	for _, set := range s.Sets.Range() {
+		r.Sets = append(r.Sets, diagnoseSet(set))
+	}
+	sort.Slice(r.Sets, func(i, j int) bool {
+		return r.Sets[i].ID < r.Sets[j].ID
+	})
+	for _, dir := range util.DataDirs() {
+		space, err := util.GetDiskSpace(dir)
+		if err != nil {
+			return nil, err
+		}
+		r.Disks = append(r.Disks, space)
+	}
+	return r, nil
+}
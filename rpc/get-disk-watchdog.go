@@ -0,0 +1,13 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// GetDiskWatchdog returns the free space of the data directories and the writers held by the disk watchdog.
+func (s *RPCService) GetDiskWatchdog(payload pcommon.RPCRequestPayload) (*engine.DiskWatchdogState, error) {
+	state := engine.Engine.DiskWatchdogState()
+	return &state, nil
+}
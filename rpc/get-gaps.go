@@ -0,0 +1,53 @@
+package rpc
+
+import (
+	setlib "pendulev2/set2"
+	"pendulev2/util"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type GetGapsRequest struct {
+	Address  pcommon.AssetAddress `json:"address"`
+	FromTime int64                `json:"from_time"` //In milliseconds, 0 for the beginning of the data history
+	ToTime   int64                `json:"to_time"`   //In milliseconds, 0 for the last parsed day
+}
+
+type GetGapsResponse struct {
+	Gaps []setlib.DayGap `json:"gaps"`
+}
+
+func (s *RPCService) GetGaps(payload pcommon.RPCRequestPayload) (*GetGapsResponse, error) {
+	r := GetGapsRequest{}
+	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := r.Address.Parse()
+	if err != nil {
+		return nil, err
+	}
+	set := s.Sets.Find(parsed.IDString())
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+
+	asset := set.Asset(r.Address)
+	if asset == nil {
+		return nil, util.ErrAssetNotFound
+	}
+
+	fromDate, toDate := "", ""
+	if r.FromTime > 0 {
+		fromDate = pcommon.Format.FormatDateStr(pcommon.NewTimeUnit(r.FromTime).ToTime())
+	}
+	if r.ToTime > 0 {
+		toDate = pcommon.Format.FormatDateStr(pcommon.NewTimeUnit(r.ToTime).ToTime())
+	}
+
+	gaps, err := asset.GetGaps(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	return &GetGapsResponse{Gaps: gaps}, nil
+}
@@ -0,0 +1,16 @@
+package rpc
+
+import (
+	setlib "pendulev2/set2"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type GetIndicatorCatalogResponse struct {
+	Indicators []setlib.IndicatorSchema `json:"indicators"`
+}
+
+// GetIndicatorCatalog lists the assets computed from other assets with the schema of their dependencies and arguments.
+func (s *RPCService) GetIndicatorCatalog(payload pcommon.RPCRequestPayload) (*GetIndicatorCatalogResponse, error) {
+	return &GetIndicatorCatalogResponse{Indicators: setlib.IndicatorCatalog()}, nil
+}
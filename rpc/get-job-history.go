@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type GetJobHistoryResponse struct {
+	Records []engine.JobRecord `json:"records"`
+}
+
+// GetJobHistory returns the finished runners matching the filter of the payload, the most recent first.
+func (s *RPCService) GetJobHistory(payload pcommon.RPCRequestPayload) (*GetJobHistoryResponse, error) {
+	r := engine.JobHistoryFilter{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return &GetJobHistoryResponse{Records: engine.Engine.JobHistory(r)}, nil
+}
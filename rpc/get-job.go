@@ -0,0 +1,19 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type JobRequest struct {
+	ID string `json:"id"`
+}
+
+func (s *RPCService) GetJob(payload pcommon.RPCRequestPayload) (*engine.JobInfo, error) {
+	r := JobRequest{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return engine.Engine.GetJob(r.ID)
+}
@@ -2,28 +2,39 @@ package rpc
 
 import (
 	setlib "pendulev2/set2"
+	engine "pendulev2/task-engine"
 
 	pcommon "github.com/pendulea/pendule-common"
 )
 
-func buildJSONSetList(sets *setlib.WorkingSets) ([]pcommon.SetJSON, error) {
-	ret := []pcommon.SetJSON{}
+// SetJSON is a set with the days of its assets whose parsing failed.
+type SetJSON struct {
+	pcommon.SetJSON
+	Failures []engine.DayFailure `json:"failures"`
+}
+
+type GetSetListResponse struct {
+	SetList []SetJSON `json:"set_list"`
+}
+
+func buildJSONSetList(sets *setlib.WorkingSets) ([]SetJSON, error) {
+	ret := []SetJSON{}
 	for _, set := range *sets {
 		d, err := set.JSON()
 		if err != nil {
 			return nil, err
 		}
-		ret = append(ret, *d)
+		ret = append(ret, SetJSON{SetJSON: *d, Failures: engine.Engine.DayFailures(set.ID())})
 	}
 	return ret, nil
 }
 
 // CheckCandlesExist checks if candles exist for the given date and time frame.
-func (s *RPCService) GetSetList(payload pcommon.RPCRequestPayload) (*pcommon.GetSetListsResponse, error) {
+func (s *RPCService) GetSetList(payload pcommon.RPCRequestPayload) (*GetSetListResponse, error) {
 	list, err := buildJSONSetList(s.Sets)
 	if err != nil {
 		return nil, err
 	}
 
-	return &pcommon.GetSetListsResponse{SetList: list}, nil
+	return &GetSetListResponse{SetList: list}, nil
 }
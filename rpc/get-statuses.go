@@ -1,16 +1,24 @@
 package rpc
 
 import (
-	"os"
 	engine "pendulev2/task-engine"
-	"syscall"
+	"pendulev2/util"
+	"runtime"
 
 	pcommon "github.com/pendulea/pendule-common"
 
 	"github.com/shirou/gopsutil/v3/mem"
 )
 
-func (s *RPCService) GetStatus(payload pcommon.RPCRequestPayload) (*pcommon.GetStatusResponse, error) {
+type GetStatusResponse struct {
+	pcommon.GetStatusResponse
+	Runners  []engine.RunnerStatus    `json:"runners"`
+	Governor engine.GovernorState     `json:"governor"`
+	Disk     engine.DiskWatchdogState `json:"disk"`
+}
+
+// GetStatus returns the typed status of the running and last finished runners, the HTML statuses are no longer rendered by the server.
+func (s *RPCService) GetStatus(payload pcommon.RPCRequestPayload) (*GetStatusResponse, error) {
 	status, err := engine.GetCSVList()
 	if err != nil {
 		return nil, err
@@ -20,22 +28,25 @@ func (s *RPCService) GetStatus(payload pcommon.RPCRequestPayload) (*pcommon.GetS
 		return nil, err
 	}
 
-	var diskSize uint64 = 0
-	if _, err := os.Stat("/mnt/ethereum"); err == nil {
-		var stat syscall.Statfs_t
-		syscall.Statfs("/mnt/ethereum", &stat)
-		diskSize = stat.Bavail * uint64(stat.Bsize)
+	disk, err := util.GetDiskSpace(pcommon.Env.DATABASES_DIR)
+	if err != nil {
+		return nil, err
 	}
 
-	r := &pcommon.GetStatusResponse{
-		CountPendingTasks:  engine.Engine.CountQueued(),
-		CountRunningTasks:  engine.Engine.CountRunning(),
-		CSVStatuses:        status,
-		HTMLStatuses:       engine.Engine.GetHTMLStatuses(),
-		CPUCount:           12,
-		AvailableMemory:    v.Available,
-		AvailableDiskSpace: diskSize,
-		MinTimeframe:       pcommon.Env.MIN_TIME_FRAME.Milliseconds(),
+	r := &GetStatusResponse{
+		GetStatusResponse: pcommon.GetStatusResponse{
+			CountPendingTasks:  engine.Engine.CountQueued(),
+			CountRunningTasks:  engine.Engine.CountRunning(),
+			CSVStatuses:        status,
+			HTMLStatuses:       []pcommon.StatusHTML{},
+			CPUCount:           runtime.NumCPU(),
+			AvailableMemory:    v.Available,
+			AvailableDiskSpace: disk.Free,
+			MinTimeframe:       pcommon.Env.MIN_TIME_FRAME.Milliseconds(),
+		},
+		Runners:  engine.Engine.GetRunnerStatuses(),
+		Governor: engine.Engine.GovernorState(),
+		Disk:     engine.Engine.DiskWatchdogState(),
 	}
 
 	return r, nil
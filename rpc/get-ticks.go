@@ -43,7 +43,7 @@ func (s *RPCService) GetTicks(payload pcommon.RPCRequestPayload) (*TickList, err
 		return nil, util.ErrSetNotFound
 	}
 
-	asset := set.Assets[r.Address]
+	asset := set.Asset(r.Address)
 	if asset == nil {
 		return nil, util.ErrAssetNotFound
 	}
@@ -68,7 +68,7 @@ func (s *RPCService) GetTicks(payload pcommon.RPCRequestPayload) (*TickList, err
 
 	fmt.Printf("Get %d Ticks %s : +%s\n", list.Len(), asset.Address(), time.Since(start).String())
 	return &TickList{
-		List:     list,
-		DataType: asset.DataType(),
+		List:     asset.ReadList(list),
+		DataType: asset.ReadDataType(),
 	}, nil
 }
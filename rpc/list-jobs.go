@@ -0,0 +1,16 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type ListJobsResponse struct {
+	Jobs []engine.JobInfo `json:"jobs"`
+}
+
+// ListJobs returns the queued, paused and running jobs in the order they were queued.
+func (s *RPCService) ListJobs(payload pcommon.RPCRequestPayload) (*ListJobsResponse, error) {
+	return &ListJobsResponse{Jobs: engine.Engine.ListJobs()}, nil
+}
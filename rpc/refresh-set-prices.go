@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"pendulev2/util"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type RefreshSetPricesRequest struct {
+	SetID  string  `json:"set_id"`
+	PriceA float64 `json:"price_a"` //USD price of the token A, 0 to fetch it
+	PriceB float64 `json:"price_b"` //USD price of the token B, 0 to fetch it
+}
+
+type RefreshSetPricesResponse struct {
+	PriceA   float64                       `json:"price_a"`
+	PriceB   float64                       `json:"price_b"`
+	Decimals map[pcommon.AssetAddress]int8 `json:"decimals"`
+}
+
+// RefreshSetPrices recomputes the stored prices of a set, the decimals of the data already stored are left unchanged.
+func (s *RPCService) RefreshSetPrices(payload pcommon.RPCRequestPayload) (*RefreshSetPricesResponse, error) {
+	r := RefreshSetPricesRequest{}
+	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
+	if err != nil {
+		return nil, err
+	}
+	set := s.Sets.Find(r.SetID)
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+
+	if r.PriceA > 0 && r.PriceB > 0 {
+		err = set.UpdatePrices(r.PriceA, r.PriceB)
+	} else {
+		err = set.RefreshPrices()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RefreshSetPricesResponse{
+		PriceA:   set.CachedTokenAPrice(),
+		PriceB:   set.CachedTokenBPrice(),
+		Decimals: make(map[pcommon.AssetAddress]int8),
+	}
+	for _, asset := range set.AssetList() {
+		res.Decimals[asset.Address()] = asset.Decimals()
+	}
+	return res, nil
+}
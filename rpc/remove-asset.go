@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"fmt"
+	manager "pendulev2/set-manager"
+	setlib "pendulev2/set2"
+	engine "pendulev2/task-engine"
+	"pendulev2/util"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type RemoveAssetRequest struct {
+	Address pcommon.AssetAddress `json:"address"`
+	DryRun  bool                 `json:"dry_run"`
+}
+
+type RemoveAssetResponse struct {
+	Affected []AffectedAsset `json:"affected"`
+}
+
+/*
+RemoveAsset removes an asset, all the assets computed from it across sets, and their data.
+With dry_run the assets that would be removed are only listed.
+*/
+func (s *RPCService) RemoveAsset(payload pcommon.RPCRequestPayload) (*RemoveAssetResponse, error) {
+	r := RemoveAssetRequest{}
+	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := r.Address.Parse()
+	if err != nil {
+		return nil, err
+	}
+	set := s.Sets.Find(parsed.IDString())
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+	if set.Asset(r.Address) == nil {
+		return nil, util.ErrAssetNotFound
+	}
+
+	impact := s.Sets.DependencyGraph().Impact(r.Address)
+	response := &RemoveAssetResponse{Affected: []AffectedAsset{}}
+	for _, asset := range impact {
+		response.Affected = append(response.Affected, newAffectedAsset(asset, asset.GetActiveTimeFrameList()))
+	}
+	if r.DryRun {
+		return response, nil
+	}
+
+	for _, asset := range impact {
+		if err := asset.SetRef.CheckAssetRemoval(asset.Address()); err != nil {
+			return nil, err
+		}
+		if err := checkAssetIdle(asset); err != nil {
+			return nil, err
+		}
+	}
+
+	//the dependents are removed first
+	for i := len(impact) - 1; i >= 0; i-- {
+		asset := impact[i]
+		//checked again under the lock of the set, a task may have started since
+		if err := asset.SetRef.RemoveAsset(asset.Address(), checkAssetIdle); err != nil {
+			return nil, err
+		}
+		logger := util.RPCLog("RemoveAsset", asset.Address())
+		if err := manager.UpdateSetInJSON(asset.SetRef.Settings); err != nil {
+			logger.WithField("error", err.Error()).Error("Error updating sets.json")
+		}
+		//the tasks queued before the removal are cancelled, so none writes the asset once its data is deleted
+		engine.Engine.CancelAssetJobs(asset.Address())
+		if err := asset.DeleteAllData(); err != nil {
+			logger.WithField("error", err.Error()).Error("Error deleting the data of the asset")
+		}
+		logger.Info("Asset removed")
+	}
+
+	return response, nil
+}
+
+// checkAssetIdle returns an error if the asset has running tasks or its arguments are being updated.
+func checkAssetIdle(asset *setlib.AssetState) error {
+	if engine.Engine.IsAssetBusy(asset.Address()) {
+		return fmt.Errorf("asset %s has running tasks", asset.Address())
+	}
+	if _, pending := pendingArgumentUpdates.Load(asset.Address()); pending {
+		return fmt.Errorf("the arguments of asset %s are being updated", asset.Address())
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+	"pendulev2/util"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type ReparseDaysRequest struct {
+	Address pcommon.AssetAddress `json:"address"`
+	Dates   []string             `json:"dates"` //formatted as "YYYY-MM-DD"
+
+	Priority *engine.Priority `json:"priority"` //overrides the priority of the parsing
+}
+
+func (s *RPCService) ReparseDays(payload pcommon.RPCRequestPayload) (interface{}, error) {
+	r := ReparseDaysRequest{}
+	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := r.Address.Parse()
+	if err != nil {
+		return nil, err
+	}
+	set := s.Sets.Find(parsed.IDString())
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+
+	asset := set.Asset(r.Address)
+	if asset == nil {
+		return nil, util.ErrAssetNotFound
+	}
+
+	for _, date := range r.Dates {
+		if err := engine.Engine.AddDayReparsing(asset, date, r.Priority); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
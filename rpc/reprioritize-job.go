@@ -0,0 +1,21 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type ReprioritizeJobRequest struct {
+	ID       string          `json:"id"`
+	Priority engine.Priority `json:"priority"`
+}
+
+// ReprioritizeJob overrides the priority of a queued job, the higher the sooner.
+func (s *RPCService) ReprioritizeJob(payload pcommon.RPCRequestPayload) (interface{}, error) {
+	r := ReprioritizeJobRequest{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return nil, engine.Engine.ReprioritizeJob(r.ID, r.Priority)
+}
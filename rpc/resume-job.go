@@ -0,0 +1,16 @@
+package rpc
+
+import (
+	engine "pendulev2/task-engine"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// ResumeJob queues again a paused job, a job paused while running is listed as stopping until its runner stopped.
+func (s *RPCService) ResumeJob(payload pcommon.RPCRequestPayload) (interface{}, error) {
+	r := JobRequest{}
+	if err := pcommon.Format.DecodeMapIntoStruct(payload, &r); err != nil {
+		return nil, err
+	}
+	return nil, engine.Engine.ResumeJob(r.ID)
+}
@@ -12,9 +12,17 @@ type RollBackAssetRequest struct {
 	Address   pcommon.AssetAddress `json:"address"`
 	ToTime    int64                `json:"to_time"`
 	Timeframe int64                `json:"timeframe"`
+	DryRun    bool                 `json:"dry_run"`
+
+	Priority *engine.Priority `json:"priority"` //overrides the priority of the rollbacks
+}
+
+type RollBackAssetResponse struct {
+	Affected []AffectedAsset `json:"affected"`
 }
 
-func (s *RPCService) RollbackAsset(payload pcommon.RPCRequestPayload) (interface{}, error) {
+// RollbackAsset rolls back the asset and all the assets computed from it, with dry_run the affected assets are only listed.
+func (s *RPCService) RollbackAsset(payload pcommon.RPCRequestPayload) (*RollBackAssetResponse, error) {
 	r := RollBackAssetRequest{}
 	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
 	if err != nil {
@@ -29,11 +37,17 @@ func (s *RPCService) RollbackAsset(payload pcommon.RPCRequestPayload) (interface
 		return nil, util.ErrSetNotFound
 	}
 
-	asset := set.Assets[r.Address]
+	asset := set.Asset(r.Address)
 	if asset == nil {
 		return nil, util.ErrAssetNotFound
 	}
 
+	timeframe := time.Duration(r.Timeframe) * time.Millisecond
+	response := &RollBackAssetResponse{Affected: rollBackImpact(asset, timeframe)}
+	if r.DryRun {
+		return response, nil
+	}
+
 	date := pcommon.Format.FormatDateStr(pcommon.NewTimeUnit(r.ToTime).ToTime())
-	return nil, engine.Engine.RollBackState(asset, date, time.Duration(r.Timeframe)*time.Millisecond)
+	return response, engine.Engine.RollBackState(asset, date, timeframe, r.Priority)
 }
@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"fmt"
+	manager "pendulev2/set-manager"
+	engine "pendulev2/task-engine"
+	"pendulev2/util"
+	"sync"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type UpdateAssetArgumentsRequest struct {
+	Address   pcommon.AssetAddress `json:"address"`
+	Arguments []string             `json:"arguments"`
+}
+
+type UpdateAssetArgumentsResponse struct {
+	OldAddress pcommon.AssetAddress `json:"old_address"`
+	NewAddress pcommon.AssetAddress `json:"new_address"`
+}
+
+// the assets being replaced, by old address
+var pendingArgumentUpdates = sync.Map{}
+
+/*
+UpdateAssetArguments replaces an asset computed from other assets by the same asset with new arguments.
+The new asset is indexed in the background on all the timeframes of the old one, then swapped in the set and sets.json,
+and the data of the old asset is deleted. The old asset stays available until the swap.
+*/
+func (s *RPCService) UpdateAssetArguments(payload pcommon.RPCRequestPayload) (*UpdateAssetArgumentsResponse, error) {
+	r := UpdateAssetArgumentsRequest{}
+	err := pcommon.Format.DecodeMapIntoStruct(payload, &r)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := r.Address.Parse()
+	if err != nil {
+		return nil, err
+	}
+	set := s.Sets.Find(parsed.IDString())
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+	old := set.Asset(r.Address)
+	if old == nil {
+		return nil, util.ErrAssetNotFound
+	}
+	if !parsed.HasDependencies() {
+		return nil, fmt.Errorf("the arguments of an asset parsed from archives can't be updated")
+	}
+	if dependents := s.Sets.Dependents(r.Address); len(dependents) > 0 {
+		return nil, fmt.Errorf("asset is a dependency of %s", dependents[0].Address())
+	}
+
+	settings := old.Settings()
+	settings.Address.Arguments = r.Arguments
+	newAsset, err := set.PrepareAsset(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, pending := pendingArgumentUpdates.LoadOrStore(r.Address, newAsset.Address()); pending {
+		return nil, fmt.Errorf("the arguments of the asset are already being updated")
+	}
+
+	done := func(err error) {
+		defer pendingArgumentUpdates.Delete(r.Address)
+		logger := util.RPCLog("UpdateAssetArguments", r.Address).WithField("new_asset", newAsset.Address())
+
+		if err == nil {
+			err = set.SwapAsset(r.Address, newAsset)
+		}
+		if err != nil {
+			logger.WithField("error", err.Error()).Error("Error updating asset arguments")
+			if err := newAsset.DeleteAllData(); err != nil {
+				logger.WithField("error", err.Error()).Error("Error deleting the data of the new asset")
+			}
+			return
+		}
+
+		if err := manager.UpdateSetInJSON(set.Settings); err != nil {
+			logger.WithField("error", err.Error()).Error("Error updating sets.json")
+		}
+		//the tasks of the old asset queued or running before the swap are stopped before its data is deleted
+		engine.Engine.CancelAssetJobs(r.Address)
+		if err := old.DeleteAllData(); err != nil {
+			logger.WithField("error", err.Error()).Error("Error deleting the data of the old asset")
+		}
+		logger.Info("Asset arguments updated")
+		go engine.Engine.RunAssetTasks(newAsset)
+	}
+
+	if err := engine.Engine.AddAssetReindexing(newAsset, old.GetActiveTimeFrameList(), done); err != nil {
+		pendingArgumentUpdates.Delete(r.Address)
+		return nil, err
+	}
+
+	return &UpdateAssetArgumentsResponse{
+		OldAddress: r.Address,
+		NewAddress: newAsset.Address(),
+	}, nil
+}
@@ -0,0 +1,185 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"go.starlark.net/starlark"
+)
+
+// TIME_COLUMN is the input column passed as an integer to the scripts.
+var TIME_COLUMN = string(pcommon.ColumnType.TIME)
+
+/*
+Builder computes the points of a script asset, tick by tick, from the aligned ticks of its dependencies.
+It has the same interface as the pendule-common indicator data builders, and must be closed to stop its worker.
+*/
+type Builder struct {
+	worker       *worker
+	hash         string
+	encodedState []byte
+	precision    int8
+}
+
+// persistedState is the prev state of a script asset: the state of the script and the hash of the script computing it.
+type persistedState struct {
+	Hash  string          `json:"hash"`
+	State json.RawMessage `json:"state"`
+}
+
+func decodePersistedState(prevState []byte) persistedState {
+	state := persistedState{}
+	json.Unmarshal(prevState, &state)
+	return state
+}
+
+// ParseParameters splits the comma separated parameters of a script asset, numbers are passed as such to init.
+func ParseParameters(parameters string) starlark.Tuple {
+	args := starlark.Tuple{}
+	if strings.TrimSpace(parameters) == "" {
+		return args
+	}
+	for _, param := range strings.Split(parameters, ",") {
+		param = strings.TrimSpace(param)
+		if v, err := strconv.ParseFloat(param, 64); err == nil {
+			args = append(args, starlark.Float(v))
+		} else {
+			args = append(args, starlark.String(param))
+		}
+	}
+	return args
+}
+
+/*
+NewBuilder resumes the state of the script from prevState, or calls init with the parameters if there is none.
+ErrScriptChanged is returned if prevState has been computed by another version of the script.
+*/
+func NewBuilder(name string, parameters string, prevState []byte, precision int8) (*Builder, error) {
+	src, hash, err := readScript(name)
+	if err != nil {
+		return nil, err
+	}
+	var persisted persistedState
+	if len(prevState) > 0 {
+		if persisted = decodePersistedState(prevState); persisted.Hash != hash {
+			return nil, fmt.Errorf("script %s: %w", name, ErrScriptChanged)
+		}
+	}
+
+	w, err := startWorker(name)
+	if err != nil {
+		return nil, err
+	}
+	b := &Builder{worker: w, hash: hash, precision: precision}
+	if _, err := w.call(workerRequest{Op: OP_LOAD, Name: name, Source: string(src)}); err != nil {
+		w.close()
+		return nil, err
+	}
+
+	req := workerRequest{Op: OP_INIT, Parameters: parameters}
+	if len(prevState) > 0 {
+		req = workerRequest{Op: OP_RESUME, State: string(persisted.State)}
+	}
+	res, err := w.call(req)
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	b.encodedState = []byte(res.State)
+	return b, nil
+}
+
+func (b *Builder) PrevState() []byte {
+	state, _ := json.Marshal(persistedState{Hash: b.hash, State: b.encodedState})
+	return state
+}
+
+// Close stops the worker of the builder.
+func (b *Builder) Close() error {
+	b.worker.close()
+	return nil
+}
+
+func inputColumns(data pcommon.Data) (map[string]float64, error) {
+	input := map[string]float64{}
+	for _, column := range data.Type().Columns() {
+		if column == pcommon.ColumnType.TIME {
+			input[TIME_COLUMN] = float64(data.GetTime().Int())
+			continue
+		}
+		v, err := data.ValueAt(column)
+		if err != nil {
+			return nil, err
+		}
+		input[string(column)] = v
+	}
+	return input, nil
+}
+
+func (b *Builder) point(value *float64) *pcommon.Point {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	if b.precision >= 0 {
+		v = pcommon.Math.RoundFloat(v, uint(b.precision))
+	}
+	return &pcommon.Point{Value: v}
+}
+
+func tickInputs(dataList []pcommon.Data) ([]map[string]float64, error) {
+	inputs := []map[string]float64{}
+	for _, data := range dataList {
+		input, err := inputColumns(data)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// ComputeUnsafe calls update with the given ticks, a None result gives a nil point.
+func (b *Builder) ComputeUnsafe(dataList ...pcommon.Data) (*pcommon.Point, error) {
+	inputs, err := tickInputs(dataList)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.worker.call(workerRequest{Op: OP_UPDATE, Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+	b.encodedState = []byte(res.State)
+	return b.point(res.Value), nil
+}
+
+// ComputeBatchUnsafe calls update with the ticks of each entry of the batch in a single round trip to the worker, a None result gives a nil point.
+func (b *Builder) ComputeBatchUnsafe(batch [][]pcommon.Data) ([]*pcommon.Point, error) {
+	req := workerRequest{Op: OP_BATCH}
+	for _, dataList := range batch {
+		inputs, err := tickInputs(dataList)
+		if err != nil {
+			return nil, err
+		}
+		req.Ticks = append(req.Ticks, inputs)
+	}
+
+	res, err := b.worker.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Values) != len(batch) {
+		return nil, fmt.Errorf("script %s: the worker returned %d values for %d ticks", b.worker.name, len(res.Values), len(batch))
+	}
+	b.encodedState = []byte(res.State)
+
+	points := make([]*pcommon.Point, len(batch))
+	for i, value := range res.Values {
+		points[i] = b.point(value)
+	}
+	return points, nil
+}
@@ -0,0 +1,169 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+)
+
+/*
+A script is a Starlark file of the SCRIPTS_DIR directory defining a stateful indicator:
+
+	def init(args):
+		# args: the parameters of the asset (numbers when they can be parsed as such, strings otherwise)
+		return {"count": 0}  # the initial state, a JSON serializable dict
+
+	def update(state, *inputs):
+		# inputs: one dict of columns per dependency, e.g. inputs[0]["close"]
+		state["count"] += 1
+		return inputs[0]["close"] / state["count"]  # a number, or None if there is no value for this tick
+
+The state is persisted with the prev state of the asset, so the indexing resumes from it.
+Scripts are sandboxed: they run in a worker process limited in memory, they can't load other files nor access the system,
+each call is limited in execution steps and time, and the serialized state is limited in size.
+The hash of the script is persisted with the state, the asset is recomputed from scratch once its script changes.
+*/
+
+const SCRIPTS_DIR_ENV = "SCRIPTS_DIR"
+const SCRIPT_EXTENSION = ".star"
+
+const (
+	MAX_INIT_STEPS   = 1_000_000
+	MAX_UPDATE_STEPS = 100_000
+	MAX_CALL_TIME    = time.Second
+	MAX_STATE_SIZE   = 1 << 20
+
+	// memory a worker can allocate, the worker is killed by the system beyond it
+	MAX_WORKER_MEMORY = 256 << 20
+)
+
+var scriptNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+var ErrScriptChanged = errors.New("the script changed since the asset was computed")
+
+type Program struct {
+	Name   string
+	init   starlark.Callable
+	update starlark.Callable
+}
+
+func Dir() string {
+	return os.Getenv(SCRIPTS_DIR_ENV)
+}
+
+func scriptPath(name string) (string, error) {
+	if !scriptNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid script name %q, only letters, digits and dashes are allowed", name)
+	}
+	if Dir() == "" {
+		return "", fmt.Errorf("%s is not set", SCRIPTS_DIR_ENV)
+	}
+	return filepath.Join(Dir(), name+SCRIPT_EXTENSION), nil
+}
+
+// newThread returns a thread limited in steps and time, load() being disabled.
+func newThread(name string, maxSteps uint64) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(maxSteps)
+	timer := time.AfterFunc(MAX_CALL_TIME, func() {
+		thread.Cancel("timeout")
+	})
+	return thread, func() { timer.Stop() }
+}
+
+// readScript returns the source of a script and its hash.
+func readScript(name string) ([]byte, string, error) {
+	path, err := scriptPath(name)
+	if err != nil {
+		return nil, "", err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("script %s not found", name)
+	}
+	hash := sha256.Sum256(src)
+	return src, hex.EncodeToString(hash[:]), nil
+}
+
+// compile executes the source of a script and returns its functions, it runs in the worker.
+func compile(name string, src []byte) (*Program, error) {
+	thread, stop := newThread(name, MAX_INIT_STEPS)
+	defer stop()
+	predeclared := starlark.StringDict{"math": math.Module, "json": json.Module}
+	globals, err := starlark.ExecFile(thread, name+SCRIPT_EXTENSION, src, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+
+	p := &Program{Name: name}
+	var ok bool
+	if p.init, ok = globals["init"].(starlark.Callable); !ok {
+		return nil, fmt.Errorf("script %s has no init function", name)
+	}
+	if p.update, ok = globals["update"].(starlark.Callable); !ok {
+		return nil, fmt.Errorf("script %s has no update function", name)
+	}
+	return p, nil
+}
+
+// Check compiles a script in a worker, returning an error if it is invalid.
+func Check(name string) error {
+	src, _, err := readScript(name)
+	if err != nil {
+		return err
+	}
+	w, err := startWorker(name)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+	_, err = w.call(workerRequest{Op: OP_LOAD, Name: name, Source: string(src)})
+	return err
+}
+
+// Changed returns true if the script differs from the one which computed the given prev state of an asset.
+func Changed(name string, prevState []byte) (bool, error) {
+	if len(prevState) == 0 {
+		return false, nil
+	}
+	_, hash, err := readScript(name)
+	if err != nil {
+		return false, err
+	}
+	return decodePersistedState(prevState).Hash != hash, nil
+}
+
+func (p *Program) call(fn starlark.Callable, maxSteps uint64, args starlark.Tuple) (starlark.Value, error) {
+	thread, stop := newThread(p.Name, maxSteps)
+	defer stop()
+	v, err := starlark.Call(thread, fn, args, nil)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", p.Name, err)
+	}
+	return v, nil
+}
+
+func (p *Program) encodeState(state starlark.Value) ([]byte, error) {
+	v, err := p.call(json.Module.Members["encode"].(starlark.Callable), MAX_UPDATE_STEPS, starlark.Tuple{state})
+	if err != nil {
+		return nil, err
+	}
+	encoded := []byte(v.(starlark.String).GoString())
+	if len(encoded) > MAX_STATE_SIZE {
+		return nil, fmt.Errorf("script %s: the state exceeds %d bytes", p.Name, MAX_STATE_SIZE)
+	}
+	return encoded, nil
+}
+
+func (p *Program) decodeState(state []byte) (starlark.Value, error) {
+	return p.call(json.Module.Members["decode"].(starlark.Callable), MAX_UPDATE_STEPS, starlark.Tuple{starlark.String(state)})
+}
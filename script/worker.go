@@ -0,0 +1,224 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+/*
+The scripts run in a worker: a child process started with the WORKER_COMMAND argument, whose memory is limited by the system.
+A script allocating too much kills its worker instead of the whole process. The worker holds the compiled script and its state,
+it answers the requests read from its standard input, one JSON object per request.
+*/
+
+const WORKER_COMMAND = "script-worker"
+
+const (
+	OP_LOAD   = "load"   // compile the source
+	OP_INIT   = "init"   // call init with the parameters
+	OP_RESUME = "resume" // decode the given state
+	OP_UPDATE = "update" // call update with the inputs
+	OP_BATCH  = "batch"  // call update with the inputs of each tick, in one round trip
+)
+
+type workerRequest struct {
+	Op         string                 `json:"op"`
+	Name       string                 `json:"name,omitempty"`
+	Source     string                 `json:"source,omitempty"`
+	Parameters string                 `json:"parameters,omitempty"`
+	State      string                 `json:"state,omitempty"`
+	Inputs     []map[string]float64   `json:"inputs,omitempty"`
+	Ticks      [][]map[string]float64 `json:"ticks,omitempty"` //the inputs of each tick of a batch
+}
+
+type workerResponse struct {
+	Error  string     `json:"error,omitempty"`
+	State  string     `json:"state,omitempty"`  //the encoded state after init, resume or update
+	Value  *float64   `json:"value,omitempty"`  //the result of update, nil if None
+	Values []*float64 `json:"values,omitempty"` //the results of update for each tick of a batch
+}
+
+// IsWorker returns true if the process has been started as a script worker.
+func IsWorker() bool {
+	return len(os.Args) > 1 && os.Args[1] == WORKER_COMMAND
+}
+
+// RunWorker answers the requests of the parent process until its standard input is closed.
+func RunWorker() {
+	limitMemory(MAX_WORKER_MEMORY)
+
+	decoder := json.NewDecoder(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	w := &workerState{}
+	for {
+		req := workerRequest{}
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+		res, err := w.handle(req)
+		if err != nil {
+			res = &workerResponse{Error: err.Error()}
+		}
+		if err := encoder.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+type workerState struct {
+	program *Program
+	state   starlark.Value
+}
+
+func (w *workerState) handle(req workerRequest) (*workerResponse, error) {
+	if req.Op == OP_LOAD {
+		program, err := compile(req.Name, []byte(req.Source))
+		if err != nil {
+			return nil, err
+		}
+		w.program = program
+		return &workerResponse{}, nil
+	}
+	if w.program == nil {
+		return nil, fmt.Errorf("no script loaded")
+	}
+
+	res := &workerResponse{}
+	var err error
+	switch req.Op {
+	case OP_INIT:
+		w.state, err = w.program.call(w.program.init, MAX_INIT_STEPS, starlark.Tuple{starlark.NewList(ParseParameters(req.Parameters))})
+	case OP_RESUME:
+		w.state, err = w.program.decodeState([]byte(req.State))
+	case OP_UPDATE:
+		res.Value, err = w.update(req.Inputs)
+	case OP_BATCH:
+		res.Values = make([]*float64, len(req.Ticks))
+		for i := 0; i < len(req.Ticks) && err == nil; i++ {
+			res.Values[i], err = w.update(req.Ticks[i])
+		}
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//the state is serialized after each call, so an invalid or oversized state fails the call updating it
+	encoded, err := w.program.encodeState(w.state)
+	if err != nil {
+		return nil, err
+	}
+	res.State = string(encoded)
+	return res, nil
+}
+
+func (w *workerState) update(inputs []map[string]float64) (*float64, error) {
+	args := starlark.Tuple{w.state}
+	for _, input := range inputs {
+		dict := starlark.NewDict(len(input))
+		for column, v := range input {
+			var value starlark.Value = starlark.Float(v)
+			if column == TIME_COLUMN {
+				value = starlark.MakeInt64(int64(v))
+			}
+			if err := dict.SetKey(starlark.String(column), value); err != nil {
+				return nil, err
+			}
+		}
+		args = append(args, dict)
+	}
+
+	result, err := w.program.call(w.program.update, MAX_UPDATE_STEPS, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var v float64
+	switch r := result.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Float:
+		v = float64(r)
+	case starlark.Int:
+		v = float64(r.Float())
+	default:
+		return nil, fmt.Errorf("script %s: update returned a %s instead of a number", w.program.Name, result.Type())
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, nil
+	}
+	return &v, nil
+}
+
+// worker is the parent side of a worker process running a script.
+type worker struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *bytes.Buffer
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func startWorker(name string) (*worker, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{name: name, cmd: exec.Command(executable, WORKER_COMMAND), stderr: &bytes.Buffer{}}
+	w.cmd.Stderr = w.stderr
+	if w.stdin, err = w.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := w.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("script %s: failed to start the worker: %w", name, err)
+	}
+	w.encoder = json.NewEncoder(w.stdin)
+	w.decoder = json.NewDecoder(stdout)
+	return w, nil
+}
+
+func (w *worker) call(req workerRequest) (*workerResponse, error) {
+	res := &workerResponse{}
+	if err := w.encoder.Encode(req); err != nil {
+		return nil, w.failure(err)
+	}
+	if err := w.decoder.Decode(res); err != nil {
+		return nil, w.failure(err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("%s", res.Error)
+	}
+	return res, nil
+}
+
+// failure returns the error of a worker which stopped answering, the first line of its output telling why (eg: out of memory).
+func (w *worker) failure(err error) error {
+	w.close()
+	reason, _, _ := strings.Cut(strings.TrimSpace(w.stderr.String()), "\n")
+	if reason == "" {
+		reason = err.Error()
+	}
+	return fmt.Errorf("script %s: the worker stopped (memory limited to %d MB): %s", w.name, MAX_WORKER_MEMORY>>20, reason)
+}
+
+func (w *worker) close() {
+	w.stdin.Close()
+	if w.cmd.ProcessState == nil {
+		w.cmd.Process.Kill()
+		w.cmd.Wait()
+	}
+}
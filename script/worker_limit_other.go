@@ -0,0 +1,10 @@
+//go:build !unix
+
+package script
+
+import "runtime/debug"
+
+// limitMemory only sets a soft limit, the system has no data segment limit to rely on.
+func limitMemory(max uint64) {
+	debug.SetMemoryLimit(int64(max))
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package script
+
+import (
+	"runtime/debug"
+	"syscall"
+)
+
+// limitMemory caps the data segment of the process, the runtime aborts once an allocation exceeds it.
+func limitMemory(max uint64) {
+	syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: max, Max: max})
+	//the garbage collector runs harder before reaching the hard limit
+	debug.SetMemoryLimit(int64(max) * 3 / 4)
+}
@@ -20,51 +20,54 @@ type SetManager struct {
 }
 
 func (pm *SetManager) Add(newSet pcommon.SetSettings, firstTimeAdd bool) error {
+	set, err := pm.add(newSet, firstTimeAdd)
+	if err != nil {
+		return err
+	}
+	if set != nil {
+		pm.runSetTasks(set)
+	}
+	return nil
+}
+
+// add loads a set, and saves it in sets.json if it is added for the first time.
+func (pm *SetManager) add(newSet pcommon.SetSettings, firstTimeAdd bool) (*setlib.Set, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
 	list, err := PullListFromJSON(GetJSONPath())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if firstTimeAdd {
 		if newSet.IDString() == "" {
-			return fmt.Errorf("set id is empty")
+			return nil, fmt.Errorf("set id is empty")
 		}
 
 		for _, p := range list {
 			if p.IDString() == newSet.IDString() {
-				return nil
+				return nil, nil
 			}
 		}
 		if err := pcommon.File.EnsureDir(newSet.DBPath()); err != nil {
-			return err
+			return nil, err
 		}
 
 		if err := UpdateListToJSON(append(list, newSet)); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	set, err := pm.sets.Add(newSet)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !firstTimeAdd && set != nil {
 		set.RunValueLogGC()
 	}
 
-	if set != nil {
-		ctx, cancel := context.WithCancel(context.Background())
-		set.AddCancelFunc(cancel)
-		util.ScheduleTaskEvery(ctx, time.Minute, func() {
-			runSetTasks(set)
-		})
-		runSetTasks(set)
-	}
-
-	return nil
+	return set, nil
 }
 
 func Init(activeSets *setlib.WorkingSets, initSetPath string) *SetManager {
@@ -93,8 +96,9 @@ func Init(activeSets *setlib.WorkingSets, initSetPath string) *SetManager {
 		}
 	}
 
+	//the tasks are run once all the sets are loaded and the job queue restored
 	for _, p := range sets {
-		if err := pm.Add(p, firstTimeAdd); err != nil {
+		if _, err := pm.add(p, firstTimeAdd); err != nil {
 			log.Fatalf("Error adding set: %s", err)
 		}
 	}
@@ -103,11 +107,35 @@ func Init(activeSets *setlib.WorkingSets, initSetPath string) *SetManager {
 		"sets": len(*activeSets),
 	}).Info("Successfully loaded sets.json file")
 
+	//the jobs queued before the last stop come first
+	engine.Engine.RestoreJobs()
+	pm.runAllTasks()
+
+	//the tasks of all the sets are run together, so the dependencies across sets are indexed first
+	util.ScheduleTaskEvery(context.Background(), time.Minute, pm.runAllTasks)
+
 	return pm
 }
 
-func runSetTasks(set *setlib.Set) {
-	for _, asset := range set.Assets {
+// orderedAssets returns the assets of all the working sets in topological order, each asset coming after its dependencies.
+func (pm *SetManager) orderedAssets() []*setlib.AssetState {
+	order, err := pm.sets.DependencyGraph().TopologicalOrder()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error ordering the assets by dependencies")
+	}
+	return order
+}
+
+func (pm *SetManager) runAllTasks() {
+	for _, asset := range pm.orderedAssets() {
 		engine.Engine.RunAssetTasks(asset)
 	}
 }
+
+func (pm *SetManager) runSetTasks(set *setlib.Set) {
+	for _, asset := range pm.orderedAssets() {
+		if asset.SetRef == set {
+			engine.Engine.RunAssetTasks(asset)
+		}
+	}
+}
@@ -42,3 +42,18 @@ func UpdateListToJSON(newList []pcommon.SetSettings) error {
 	}
 	return nil
 }
+
+// UpdateSetInJSON replaces the settings of a set in the sets.json file.
+func UpdateSetInJSON(settings pcommon.SetSettings) error {
+	list, err := PullListFromJSON(GetJSONPath())
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].IDString() == settings.IDString() {
+			list[i] = settings
+			return UpdateListToJSON(list)
+		}
+	}
+	return fmt.Errorf("set %s not found in sets.json", settings.IDString())
+}
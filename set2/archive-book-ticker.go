@@ -0,0 +1,97 @@
+package set2
+
+import (
+	"pendulev2/exchange"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+const BINANCE_BOOK_TICKER = exchange.BINANCE_BOOK_TICKER
+
+const (
+	BOOK_BID_PRICE pcommon.AssetType = "book_bid_price"
+	BOOK_BID_QTY   pcommon.AssetType = "book_bid_qty"
+	BOOK_ASK_PRICE pcommon.AssetType = "book_ask_price"
+	BOOK_ASK_QTY   pcommon.AssetType = "book_ask_qty"
+
+	BOOK_SPREAD    pcommon.AssetType = "book_spread"
+	BOOK_MID_PRICE pcommon.AssetType = "book_mid_price"
+	BOOK_IMBALANCE pcommon.AssetType = "book_imbalance"
+)
+
+var BINANCE_BOOK_TICKER_ARCHIVE_TREE = pcommon.ArchiveDataTree{
+	ConsistencyMaxLookbackDays: 3,
+	Time: pcommon.AssetBranch{
+		OriginColumnTitle: "transaction_time",
+		OriginColumnIndex: 5,
+		DataFilter:        pcommon.GenericTimeDataFilter,
+	},
+	Columns: []pcommon.AssetBranch{
+		{OriginColumnTitle: "best_bid_price", OriginColumnIndex: 1, Asset: BOOK_BID_PRICE},
+		{OriginColumnTitle: "best_bid_qty", OriginColumnIndex: 2, Asset: BOOK_BID_QTY},
+		{OriginColumnTitle: "best_ask_price", OriginColumnIndex: 3, Asset: BOOK_ASK_PRICE},
+		{OriginColumnTitle: "best_ask_qty", OriginColumnIndex: 4, Asset: BOOK_ASK_QTY},
+	},
+}
+
+var spreadLine = func(values []float64, args []string) (float64, bool) {
+	return values[1] - values[0], true
+}
+
+var midPriceLine = func(values []float64, args []string) (float64, bool) {
+	return (values[0] + values[1]) / 2, true
+}
+
+// values are [bid qty, ask qty], the imbalance goes from -1 (only asks) to 1 (only bids)
+var imbalanceLine = func(values []float64, args []string) (float64, bool) {
+	total := values[0] + values[1]
+	if total == 0 {
+		return 0, false
+	}
+	return (values[0] - values[1]) / total, true
+}
+
+/*
+registerBookTickerArchive adds the top of book archive to the archives of the exchange package, the lists of the common library being left untouched.
+Its source assets are known to the library like the derived assets, and filtered out by LibrarySettings.
+*/
+func registerBookTickerArchive() {
+	exchange.RegisterArchive(BINANCE_BOOK_TICKER, &BINANCE_BOOK_TICKER_ARCHIVE_TREE)
+
+	priceDecimals := pcommon.DEFAULT_ASSETS[pcommon.Asset.FUTURES_PRICE].SetUpDecimals
+	volumeDecimals := pcommon.DEFAULT_ASSETS[pcommon.Asset.FUTURES_VOLUME].SetUpDecimals
+
+	sources := []pcommon.AssetStateConfig{
+		{SetUpDecimals: priceDecimals, ID: BOOK_BID_PRICE, DataType: pcommon.UNIT, Label: "Best Bid Price", Description: "The highest price a buyer is willing to pay in the futures order book on Binance.", Color: "#3cb371"},
+		{SetUpDecimals: volumeDecimals, ID: BOOK_BID_QTY, DataType: pcommon.UNIT, Label: "Best Bid Quantity", Description: "The quantity available at the best bid price in the futures order book on Binance.", Color: "#2e8b57"},
+		{SetUpDecimals: priceDecimals, ID: BOOK_ASK_PRICE, DataType: pcommon.UNIT, Label: "Best Ask Price", Description: "The lowest price a seller is willing to accept in the futures order book on Binance.", Color: "#cd5c5c"},
+		{SetUpDecimals: volumeDecimals, ID: BOOK_ASK_QTY, DataType: pcommon.UNIT, Label: "Best Ask Quantity", Description: "The quantity available at the best ask price in the futures order book on Binance.", Color: "#b22222"},
+	}
+	for _, config := range sources {
+		pcommon.DEFAULT_ASSETS[config.ID] = config
+		pcommon.AssetTypeMap[string(config.ID)] = true
+	}
+}
+
+func registerBookTickerAssets() {
+	priceDecimals := pcommon.DEFAULT_ASSETS[pcommon.Asset.FUTURES_PRICE].SetUpDecimals
+	ratioDecimals := func(priceUSDA, priceUSDB float64) int8 {
+		return 4
+	}
+
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{BOOK_BID_PRICE, BOOK_ASK_PRICE}, Line: spreadLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: BOOK_SPREAD, DataType: pcommon.UNIT,
+		Label: "Bid/Ask Spread", Description: "The difference between the best ask and the best bid prices in the futures order book on Binance.",
+		Color: "#ff8c00",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{BOOK_BID_PRICE, BOOK_ASK_PRICE}, Line: midPriceLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: BOOK_MID_PRICE, DataType: pcommon.UNIT,
+		Label: "Mid Price", Description: "The average of the best bid and the best ask prices in the futures order book on Binance.",
+		Color: "#4682b4",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{BOOK_BID_QTY, BOOK_ASK_QTY}, Line: imbalanceLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: ratioDecimals, ID: BOOK_IMBALANCE, DataType: pcommon.UNIT,
+		Label: "Top of Book Imbalance", Description: "The ratio (bid - ask) / (bid + ask) of the quantities available at the best bid and ask prices, from -1 to 1.",
+		Color: "#9370db",
+	})
+}
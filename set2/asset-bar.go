@@ -0,0 +1,192 @@
+package set2
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+/*
+BarAsset describes an asset whose candles are not bounded by time but by a threshold on a quantity cumulated over the trades.
+Bars are built from the minimum timeframe ticks of a price (unit) and a volume (quantity) dependency,
+and stored on the minimum timeframe at the time of the tick closing them.
+*/
+type BarAsset struct {
+	// Contribution returns the amount a tick adds to the cumulated quantity of the bar.
+	Contribution func(price pcommon.UnitTime, volume pcommon.QuantityTime) float64
+}
+
+const (
+	VOLUME_BAR    pcommon.AssetType = "volume_bar"
+	DOLLAR_BAR    pcommon.AssetType = "dollar_bar"
+	TICK_BAR      pcommon.AssetType = "tick_bar"
+	IMBALANCE_BAR pcommon.AssetType = "imbalance_bar"
+)
+
+var BAR_ASSETS = map[pcommon.AssetType]BarAsset{}
+
+func IsBarAsset(assetType pcommon.AssetType) bool {
+	_, ok := BAR_ASSETS[assetType]
+	return ok
+}
+
+var volumeContribution = func(price pcommon.UnitTime, volume pcommon.QuantityTime) float64 {
+	return volume.Plus + volume.Minus
+}
+
+var dollarContribution = func(price pcommon.UnitTime, volume pcommon.QuantityTime) float64 {
+	return (volume.Plus + volume.Minus) * price.Close
+}
+
+var tickContribution = func(price pcommon.UnitTime, volume pcommon.QuantityTime) float64 {
+	return float64(price.Count)
+}
+
+// the imbalance is signed, the bar closes once the buys exceed the sells (or the opposite) by the threshold
+var imbalanceContribution = func(price pcommon.UnitTime, volume pcommon.QuantityTime) float64 {
+	return volume.Plus - volume.Minus
+}
+
+// barState is the bar being built, persisted in the prev state of the asset between two indexings.
+type barState struct {
+	Cumulated   float64   `json:"cumulated"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	AbsoluteSum float64   `json:"absolute_sum"`
+	Count       int64     `json:"count"`
+	Closes      []float64 `json:"closes"`
+}
+
+type BarBuilder struct {
+	bar       BarAsset
+	threshold float64
+	state     barState
+}
+
+// NewBarBuilder resumes the bar being built from the state stored in the prev state of the asset (empty for a new asset).
+func NewBarBuilder(assetType pcommon.AssetType, args []string, prevState []byte) (*BarBuilder, error) {
+	bar, ok := BAR_ASSETS[assetType]
+	if !ok {
+		return nil, fmt.Errorf("asset %s is not a bar", assetType)
+	}
+	threshold, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := &BarBuilder{bar: bar, threshold: threshold}
+	if len(prevState) > 0 {
+		if err := json.Unmarshal(prevState, &builder.state); err != nil {
+			return nil, err
+		}
+	}
+	return builder, nil
+}
+
+/*
+Push adds a minimum timeframe tick to the bar being built, and returns the bars the tick closes.
+The volume is zero if the volume dependency has no tick at the same time.
+
+A tick crossing the threshold several times closes one bar per crossing: the first one holds the bar being built,
+the next ones only hold the tick and are flat at its close price. They are spaced by one time unit from the tick time,
+so a tick closes at most one bar per time unit of the minimum timeframe, the crossings left are carried to the next tick.
+*/
+func (b *BarBuilder) Push(price pcommon.UnitTime, volume pcommon.QuantityTime) []pcommon.UnitTime {
+	if price.Count == 0 || price.Open == 0.00 {
+		return nil
+	}
+
+	s := &b.state
+	if s.Count == 0 {
+		s.Open, s.High, s.Low = price.Open, price.High, price.Low
+	}
+	s.High = math.Max(s.High, price.High)
+	s.Low = math.Min(s.Low, price.Low)
+	s.Close = price.Close
+	s.AbsoluteSum += price.AbsoluteSum
+	s.Count += price.Count
+	s.Closes = append(s.Closes, price.Close)
+	s.Cumulated += b.bar.Contribution(price, volume)
+
+	if math.Abs(s.Cumulated) < b.threshold {
+		return nil
+	}
+
+	bars := []pcommon.UnitTime{{
+		Unit: pcommon.Unit{
+			Open:        s.Open,
+			High:        s.High,
+			Low:         s.Low,
+			Close:       s.Close,
+			Average:     pcommon.Math.SafeAverage(s.Closes),
+			Median:      pcommon.Math.SafeMedian(s.Closes),
+			AbsoluteSum: s.AbsoluteSum,
+			Count:       s.Count,
+		},
+		Time: price.Time,
+	}}
+
+	//the imbalance is signed, the remainder keeps the sign of the cumulated amount
+	crossing := math.Copysign(b.threshold, s.Cumulated)
+	remainder := s.Cumulated - crossing
+	maxBars := int(pcommon.Env.MIN_TIME_FRAME / pcommon.TIME_UNIT_DURATION)
+	for math.Abs(remainder) >= b.threshold && len(bars) < maxBars {
+		bars = append(bars, pcommon.NewUnit(price.Close).ToTime(price.Time.Add(time.Duration(len(bars))*pcommon.TIME_UNIT_DURATION)))
+		remainder -= crossing
+	}
+	b.state = barState{Cumulated: remainder}
+	return bars
+}
+
+func (b *BarBuilder) State() []byte {
+	state, _ := json.Marshal(b.state)
+	return state
+}
+
+func registerBarAsset(bar BarAsset, config pcommon.AssetStateConfig) {
+	BAR_ASSETS[config.ID] = bar
+	INDICATOR_ARGUMENTS[config.ID] = IndicatorArguments{
+		Dependencies: []DependencySchema{{Name: "price"}, {Name: "volume"}},
+		Arguments:    []ArgumentSchema{{Name: "threshold", Kind: ARGUMENT_KIND_FLOAT, Description: "The cumulated amount closing a bar.", Min: bound(0), MinExclusive: true}},
+	}
+	pcommon.DEFAULT_ASSETS[config.ID] = config
+	pcommon.AssetTypeMap[string(config.ID)] = true
+}
+
+func registerBarAssets() {
+	priceDecimals := pcommon.DEFAULT_ASSETS[pcommon.Asset.FUTURES_PRICE].SetUpDecimals
+	dependencies := []pcommon.DataType{pcommon.UNIT, pcommon.QUANTITY}
+	thresholdArgument := []reflect.Type{reflect.TypeOf(float64(0))}
+
+	registerBarAsset(BarAsset{Contribution: volumeContribution}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: VOLUME_BAR, DataType: pcommon.UNIT,
+		RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: thresholdArgument,
+		Label: "Volume Bars", Description: "Price candles closing each time the traded volume reaches the given threshold.",
+		Color: "#1e90ff",
+	})
+	registerBarAsset(BarAsset{Contribution: dollarContribution}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: DOLLAR_BAR, DataType: pcommon.UNIT,
+		RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: thresholdArgument,
+		Label: "Dollar Bars", Description: "Price candles closing each time the traded notional (volume x price) reaches the given threshold.",
+		Color: "#228b22",
+	})
+	registerBarAsset(BarAsset{Contribution: tickContribution}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: TICK_BAR, DataType: pcommon.UNIT,
+		RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: thresholdArgument,
+		Label: "Tick Bars", Description: "Price candles closing each time the number of trades reaches the given threshold.",
+		Color: "#ff6347",
+	})
+	registerBarAsset(BarAsset{Contribution: imbalanceContribution}, pcommon.AssetStateConfig{
+		SetUpDecimals: priceDecimals, ID: IMBALANCE_BAR, DataType: pcommon.UNIT,
+		RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: thresholdArgument,
+		Label: "Imbalance Bars", Description: "Price candles closing each time the difference between the bought and sold volumes reaches the given threshold.",
+		Color: "#c71585",
+	})
+}
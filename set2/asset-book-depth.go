@@ -0,0 +1,73 @@
+package set2
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+const (
+	BOOK_DEPTH_BID_BPS pcommon.AssetType = "book_depth_bid_bps"
+	BOOK_DEPTH_ASK_BPS pcommon.AssetType = "book_depth_ask_bps"
+)
+
+// values are the depths at 1% to 5% from the price, the depth at N bps is linearly interpolated between them
+var depthAtBpsLine = func(values []float64, args []string) (float64, bool) {
+	bps, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || bps <= 0 || bps > 500 {
+		return 0, false
+	}
+	level := int(bps / 100)
+	prevDepth := 0.0
+	if level > 0 {
+		prevDepth = values[level-1]
+	}
+	if level == len(values) {
+		return prevDepth, true
+	}
+	ratio := float64(bps%100) / 100
+	return prevDepth + (values[level]-prevDepth)*ratio, true
+}
+
+func validateDepthBps(args []string) error {
+	bps, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	if bps <= 0 || bps > 500 {
+		return fmt.Errorf("depth must be between 1 and 500 bps")
+	}
+	return nil
+}
+
+func registerBookDepthAssets() {
+	depthDecimals := pcommon.DEFAULT_ASSETS[pcommon.Asset.BOOK_DEPTH_P1].SetUpDecimals
+
+	bpsArgument := []reflect.Type{reflect.TypeOf(int64(0))}
+	registerDerivedAsset(DerivedAsset{
+		Sources: []pcommon.AssetType{
+			pcommon.Asset.BOOK_DEPTH_M1, pcommon.Asset.BOOK_DEPTH_M2, pcommon.Asset.BOOK_DEPTH_M3, pcommon.Asset.BOOK_DEPTH_M4, pcommon.Asset.BOOK_DEPTH_M5,
+		},
+		JoinOnTime:        true,
+		Line:              depthAtBpsLine,
+		ValidateArguments: validateDepthBps,
+	}, pcommon.AssetStateConfig{
+		SetUpDecimals: depthDecimals, ID: BOOK_DEPTH_BID_BPS, DataType: pcommon.UNIT, RequiredArgumentTypes: bpsArgument,
+		Label: "Bid Depth at N bps", Description: "The liquidity available down to N basis points (1 to 500) below the current price, interpolated from the order book depth on Binance.",
+		Color: "#0b186b",
+	})
+	registerDerivedAsset(DerivedAsset{
+		Sources: []pcommon.AssetType{
+			pcommon.Asset.BOOK_DEPTH_P1, pcommon.Asset.BOOK_DEPTH_P2, pcommon.Asset.BOOK_DEPTH_P3, pcommon.Asset.BOOK_DEPTH_P4, pcommon.Asset.BOOK_DEPTH_P5,
+		},
+		JoinOnTime:        true,
+		Line:              depthAtBpsLine,
+		ValidateArguments: validateDepthBps,
+	}, pcommon.AssetStateConfig{
+		SetUpDecimals: depthDecimals, ID: BOOK_DEPTH_ASK_BPS, DataType: pcommon.UNIT, RequiredArgumentTypes: bpsArgument,
+		Label: "Ask Depth at N bps", Description: "The liquidity available up to N basis points (1 to 500) above the current price, interpolated from the order book depth on Binance.",
+		Color: "#044f56",
+	})
+}
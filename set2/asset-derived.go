@@ -0,0 +1,228 @@
+package set2
+
+import (
+	"math"
+	"pendulev2/exchange"
+	"reflect"
+	"strconv"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+/*
+DerivedAsset describes an asset computed from the CSV lines of one or several source assets of the same archive.
+The CSV lines of the sources are expected to be aligned (same count, same order, same timestamps).
+*/
+type DerivedAsset struct {
+	Sources []pcommon.AssetType
+
+	// Line maps the aligned values of a CSV line to the value stored for this line, ok is false if the line must be skipped.
+	Line func(values []float64, args []string) (value float64, ok bool)
+
+	// Bucket, if set, replaces Line and computes the data of a minimum timeframe bucket from all its lines.
+	Bucket func(lines [][]float64, args []string, bucketTime pcommon.TimeUnit) (data pcommon.Data, ok bool)
+
+	// Read, if set, derives at read time the data served to the readers from the stored one, their type being ReadType.
+	// The stored data is aggregated over the higher timeframes, so it holds what the derivation needs (e.g. the sums of a weighted average).
+	Read     func(stored pcommon.Data) (data pcommon.Data, ok bool)
+	ReadType pcommon.DataType
+
+	// Composable is true if the data served to the readers only depends on the sums, the extremes, the first and last values of the stored data,
+	// so the candles of a timeframe can be built from the ones of a smaller timeframe nesting into them.
+	Composable bool
+
+	// ValidateArguments optionally checks the arguments of the asset beyond their type.
+	ValidateArguments func(args []string) error
+
+	// JoinOnTime joins the source lines on their timestamp instead of their position, the timestamps missing in a source are skipped.
+	JoinOnTime bool
+}
+
+const (
+	SPOT_BUY_VOLUME        pcommon.AssetType = "spot_buy_volume"
+	SPOT_SELL_VOLUME       pcommon.AssetType = "spot_sell_volume"
+	SPOT_TRADE_COUNT       pcommon.AssetType = "spot_trade_count"
+	SPOT_VWAP              pcommon.AssetType = "spot_vwap"
+	SPOT_LARGE_TRADE_COUNT pcommon.AssetType = "spot_large_trade_count"
+
+	FUTURES_BUY_VOLUME        pcommon.AssetType = "futures_buy_volume"
+	FUTURES_SELL_VOLUME       pcommon.AssetType = "futures_sell_volume"
+	FUTURES_TRADE_COUNT       pcommon.AssetType = "futures_trade_count"
+	FUTURES_VWAP              pcommon.AssetType = "futures_vwap"
+	FUTURES_LARGE_TRADE_COUNT pcommon.AssetType = "futures_large_trade_count"
+)
+
+var DERIVED_ASSETS = map[pcommon.AssetType]DerivedAsset{}
+
+/*
+ARCHIVE_DERIVED_ASSETS maps the derived assets without arguments to the archive of their sources.
+The archive trees of the common library are left untouched, so its set type checks are done on LibrarySettings.
+*/
+var ARCHIVE_DERIVED_ASSETS = map[pcommon.AssetType]pcommon.ArchiveType{}
+
+func IsDerivedAsset(assetType pcommon.AssetType) bool {
+	_, ok := DERIVED_ASSETS[assetType]
+	return ok
+}
+
+// RequiredArchiveType returns the archive an asset is parsed from, the archive of its sources for a derived asset.
+func RequiredArchiveType(assetType pcommon.AssetType) *pcommon.ArchiveType {
+	if derived, ok := DERIVED_ASSETS[assetType]; ok {
+		return exchange.ArchiveOf(derived.Sources[0])
+	}
+	return exchange.ArchiveOf(assetType)
+}
+
+// ArchiveAssets returns the assets parsed from an archive, including the derived assets without arguments.
+func ArchiveAssets(archiveType pcommon.ArchiveType) []pcommon.AssetType {
+	ret := []pcommon.AssetType{}
+	if tree, ok := exchange.ArchiveTree(archiveType); ok {
+		for _, branch := range tree.Columns {
+			ret = append(ret, branch.Asset)
+		}
+	}
+	for assetType, derivedArchiveType := range ARCHIVE_DERIVED_ASSETS {
+		if derivedArchiveType == archiveType {
+			ret = append(ret, assetType)
+		}
+	}
+	return ret
+}
+
+// LibrarySettings returns a copy of the settings without the derived assets and the assets of archives unknown to the common library, which its set types don't know.
+func LibrarySettings(settings pcommon.SetSettings) pcommon.SetSettings {
+	ret := settings.Copy()
+	ret.Assets = lo.Filter(ret.Assets, func(asset pcommon.AssetSettings, _ int) bool {
+		if _, ok := ARCHIVE_DERIVED_ASSETS[asset.Address.AssetType]; ok {
+			return false
+		}
+		archiveType := exchange.ArchiveOf(asset.Address.AssetType)
+		return archiveType == nil || !exchange.IsLocalArchive(*archiveType)
+	})
+	return *ret
+}
+
+// ReadDataTypeOf returns the type of the data served to the readers of an asset type.
+func ReadDataTypeOf(assetType pcommon.AssetType) pcommon.DataType {
+	if derived, ok := DERIVED_ASSETS[assetType]; ok && derived.Read != nil {
+		return derived.ReadType
+	}
+	return pcommon.DEFAULT_ASSETS[assetType].DataType
+}
+
+// volume values are signed in the trade archives: positive for buys, negative for sells
+var buyVolumeLine = func(values []float64, args []string) (float64, bool) {
+	return values[0], values[0] > 0
+}
+
+var sellVolumeLine = func(values []float64, args []string) (float64, bool) {
+	return -values[0], values[0] < 0
+}
+
+var tradeCountLine = func(values []float64, args []string) (float64, bool) {
+	return 1, true
+}
+
+var largeTradeCountLine = func(values []float64, args []string) (float64, bool) {
+	threshold, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return 1, math.Abs(values[0]) >= threshold
+}
+
+/*
+The VWAP is stored as a quantity holding the sum of price x volume (plus) and the sum of volume (minus) of the trades,
+the sums of the higher timeframes being weighted by volume, and it is derived at read time as a point.
+Both sums are always set, so the quantity is stored in its full form. The lines values are [price, signed volume].
+*/
+var vwapBucket = func(lines [][]float64, args []string, bucketTime pcommon.TimeUnit) (pcommon.Data, bool) {
+	sumPriceVolume, sumVolume := 0.0, 0.0
+	for _, line := range lines {
+		volume := math.Abs(line[1])
+		sumPriceVolume += line[0] * volume
+		sumVolume += volume
+	}
+	if sumVolume == 0 || sumPriceVolume <= 0 {
+		return nil, false
+	}
+	return pcommon.Quantity{
+		Plus: sumPriceVolume, PlusAvg: sumPriceVolume, PlusMed: sumPriceVolume, PlusCount: 1,
+		Minus: sumVolume, MinusAvg: sumVolume, MinusMed: sumVolume, MinusCount: 1,
+	}.ToTime(bucketTime), true
+}
+
+var vwapRead = func(stored pcommon.Data) (pcommon.Data, bool) {
+	sums, ok := stored.(pcommon.QuantityTime)
+	if !ok || sums.Minus == 0 {
+		return nil, false
+	}
+	return pcommon.PointTime{Point: pcommon.Point{Value: sums.Plus / sums.Minus}, Time: sums.Time}, true
+}
+
+// registerDerivedAsset adds the derived asset to the asset types known by the common library, and to the archive of its sources if it has no arguments.
+func registerDerivedAsset(derived DerivedAsset, config pcommon.AssetStateConfig) {
+	DERIVED_ASSETS[config.ID] = derived
+	pcommon.DEFAULT_ASSETS[config.ID] = config
+	pcommon.AssetTypeMap[string(config.ID)] = true
+
+	if len(config.RequiredArgumentTypes) > 0 {
+		return
+	}
+	if archiveType := exchange.ArchiveOf(derived.Sources[0]); archiveType != nil {
+		ARCHIVE_DERIVED_ASSETS[config.ID] = *archiveType
+	}
+}
+
+func registerTradeDerivedAssets(price, volume pcommon.AssetType, buyVolume, sellVolume, tradeCount, vwap, largeTradeCount pcommon.AssetType, market string) {
+	volumeDecimals := pcommon.DEFAULT_ASSETS[volume].SetUpDecimals
+	priceDecimals := pcommon.DEFAULT_ASSETS[price].SetUpDecimals
+	//the sums of the VWAP keep the precision of both the prices and the volumes
+	sumDecimals := func(priceUSDA, priceUSDB float64) int8 {
+		return int8(math.Max(float64(priceDecimals(priceUSDA, priceUSDB)), float64(volumeDecimals(priceUSDA, priceUSDB))))
+	}
+	countDecimals := func(priceUSDA, priceUSDB float64) int8 {
+		return 0
+	}
+
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{volume}, Line: buyVolumeLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: volumeDecimals, ID: buyVolume, DataType: pcommon.QUANTITY,
+		Label: market + " Buy Volume", Description: "The amount of an asset bought by takers in the " + market + " market on Binance.",
+		Color: "#2e8b57",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{volume}, Line: sellVolumeLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: volumeDecimals, ID: sellVolume, DataType: pcommon.QUANTITY,
+		Label: market + " Sell Volume", Description: "The amount of an asset sold by takers in the " + market + " market on Binance.",
+		Color: "#b22222",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{volume}, Line: tradeCountLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: countDecimals, ID: tradeCount, DataType: pcommon.QUANTITY,
+		Label: market + " Trade Count", Description: "The number of trades executed in the " + market + " market on Binance.",
+		Color: "#6a5acd",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{price, volume}, Bucket: vwapBucket, Read: vwapRead, ReadType: pcommon.POINT, Composable: true}, pcommon.AssetStateConfig{
+		SetUpDecimals: sumDecimals, ID: vwap, DataType: pcommon.QUANTITY,
+		Label: market + " VWAP", Description: "The volume weighted average price of the trades of each candle in the " + market + " market on Binance.",
+		Color: "#daa520",
+	})
+	registerDerivedAsset(DerivedAsset{Sources: []pcommon.AssetType{volume}, Line: largeTradeCountLine}, pcommon.AssetStateConfig{
+		SetUpDecimals: countDecimals, ID: largeTradeCount, DataType: pcommon.QUANTITY,
+		RequiredArgumentTypes: []reflect.Type{reflect.TypeOf(float64(0))},
+		Label:                 market + " Large Trade Count", Description: "The number of trades whose amount is greater or equal to the given threshold in the " + market + " market on Binance.",
+		Color: "#8b008b",
+	})
+}
+
+func init() {
+	registerBookTickerArchive()
+	registerBookTickerAssets()
+	registerBookDepthAssets()
+	registerTradeDerivedAssets(pcommon.Asset.SPOT_PRICE, pcommon.Asset.SPOT_VOLUME,
+		SPOT_BUY_VOLUME, SPOT_SELL_VOLUME, SPOT_TRADE_COUNT, SPOT_VWAP, SPOT_LARGE_TRADE_COUNT, "Spot")
+	registerTradeDerivedAssets(pcommon.Asset.FUTURES_PRICE, pcommon.Asset.FUTURES_VOLUME,
+		FUTURES_BUY_VOLUME, FUTURES_SELL_VOLUME, FUTURES_TRADE_COUNT, FUTURES_VWAP, FUTURES_LARGE_TRADE_COUNT, "Futures")
+	registerBarAssets()
+	registerFormulaAssets()
+	registerScriptAssets()
+}
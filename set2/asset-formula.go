@@ -0,0 +1,55 @@
+package set2
+
+import (
+	"fmt"
+	"pendulev2/formula"
+	"reflect"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// FORMULA_ASSETS are the formula assets by number of dependencies, their only argument is the expression combining the dependencies.
+var FORMULA_ASSETS = []pcommon.AssetType{"formula1", "formula2", "formula3", "formula4"}
+
+const FORMULA_DECIMALS = 8
+
+func IsFormulaAsset(assetType pcommon.AssetType) bool {
+	for _, t := range FORMULA_ASSETS {
+		if t == assetType {
+			return true
+		}
+	}
+	return false
+}
+
+func registerFormulaAssets() {
+	decimals := func(priceUSDA, priceUSDB float64) int8 {
+		return FORMULA_DECIMALS
+	}
+
+	for i, assetType := range FORMULA_ASSETS {
+		depCount := i + 1
+		dependencies := make([]pcommon.DataType, depCount)
+		dependencySchemas := make([]DependencySchema, depCount)
+		for j := range dependencies {
+			dependencies[j] = -1
+			dependencySchemas[j] = DependencySchema{Name: formula.DEPENDENCY_NAMES[j]}
+		}
+
+		pcommon.DEFAULT_ASSETS[assetType] = pcommon.AssetStateConfig{
+			SetUpDecimals: decimals, ID: assetType, DataType: pcommon.POINT,
+			RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: []reflect.Type{reflect.TypeOf("")},
+			Label:       fmt.Sprintf("Formula (%d assets)", depCount),
+			Description: "A user-defined expression over the dependencies, such as spreads, ratios, lags and rolling means, standard deviations or z-scores.",
+			Color:       "#708090",
+		}
+		pcommon.AssetTypeMap[string(assetType)] = true
+		INDICATOR_ARGUMENTS[assetType] = IndicatorArguments{
+			Dependencies: dependencySchemas,
+			Arguments: []ArgumentSchema{{
+				Name: "expression", Kind: ARGUMENT_KIND_FORMULA,
+				Description: "The expression combining the dependencies named A, B, C and D, e.g. zscore(close(A) / close(B), 500).",
+			}},
+		}
+	}
+}
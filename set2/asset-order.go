@@ -159,6 +159,22 @@ func (order CSVOrderPacked) Unpack(sets WorkingSets) (*CSVOrderUnpacked, error)
 	return &CSVOrderUnpacked{order.Header, orders}, nil
 }
 
+// Pack returns the order as received from the clients, each order being the asset address followed by its columns.
+func (order *CSVOrderUnpacked) Pack() CSVOrderPacked {
+	packed := CSVOrderPacked{Header: order.Header, Orders: [][]string{}}
+	for _, o := range order.Orders {
+		columns := []string{}
+		for column, required := range o.Columns {
+			if required {
+				columns = append(columns, string(column))
+			}
+		}
+		sort.Strings(columns)
+		packed.Orders = append(packed.Orders, append([]string{string(o.Asset.Address())}, columns...))
+	}
+	return packed
+}
+
 func parseArrayOrder(sets WorkingSets, timeframe time.Duration, listRawOrders [][]string) (CSVAssetList, error) {
 	orders := CSVAssetList{}
 
@@ -178,7 +194,7 @@ func parseArrayOrder(sets WorkingSets, timeframe time.Duration, listRawOrders []
 		if set == nil {
 			return nil, fmt.Errorf("set %s not found", setID)
 		}
-		assetState := set.Assets[assetAddress]
+		assetState := set.Asset(assetAddress)
 		if assetState == nil {
 			return nil, fmt.Errorf("asset %s not found in set %s", assetAddress, setID)
 		}
@@ -188,7 +204,7 @@ func parseArrayOrder(sets WorkingSets, timeframe time.Duration, listRawOrders []
 
 		requirements := pcommon.CSVCheckListRequirement{}
 		for _, column := range columns {
-			if lo.IndexOf(assetState.DataType().Columns(), pcommon.ColumnName(column)) == -1 {
+			if lo.IndexOf(assetState.ReadDataType().Columns(), pcommon.ColumnName(column)) == -1 {
 				return nil, fmt.Errorf("asset %s does not have column %s", assetAddress, column)
 			}
 			requirements[pcommon.ColumnName(column)] = true
@@ -225,7 +241,7 @@ func (parameters *CSVOrderUnpacked) BuildCSVHeader() ([]string, error) {
 			eRR = err
 			return nil
 		}
-		return order.Asset.DataType().Header(prefix, order.Columns)
+		return order.Asset.ReadDataType().Header(prefix, order.Columns)
 	})
 	if eRR != nil {
 		return nil, eRR
@@ -305,7 +321,7 @@ func (parameters *CSVOrderUnpacked) FetchOrderData(froms *[]pcommon.TimeUnit) (m
 			}
 
 			mu.Lock()
-			listData[state.Address()] = data
+			listData[state.Address()] = state.ReadList(data)
 			mu.Unlock()
 		}(i, order.Asset)
 	}
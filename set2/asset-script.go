@@ -0,0 +1,55 @@
+package set2
+
+import (
+	"fmt"
+	"pendulev2/formula"
+	"reflect"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// SCRIPT_ASSETS are the script assets by number of dependencies, their arguments are the script name and its comma separated parameters.
+var SCRIPT_ASSETS = []pcommon.AssetType{"script1", "script2", "script3", "script4"}
+
+const SCRIPT_DECIMALS = 8
+
+func IsScriptAsset(assetType pcommon.AssetType) bool {
+	for _, t := range SCRIPT_ASSETS {
+		if t == assetType {
+			return true
+		}
+	}
+	return false
+}
+
+func registerScriptAssets() {
+	decimals := func(priceUSDA, priceUSDB float64) int8 {
+		return SCRIPT_DECIMALS
+	}
+
+	for i, assetType := range SCRIPT_ASSETS {
+		depCount := i + 1
+		dependencies := make([]pcommon.DataType, depCount)
+		dependencySchemas := make([]DependencySchema, depCount)
+		for j := range dependencies {
+			dependencies[j] = -1
+			dependencySchemas[j] = DependencySchema{Name: formula.DEPENDENCY_NAMES[j]}
+		}
+
+		pcommon.DEFAULT_ASSETS[assetType] = pcommon.AssetStateConfig{
+			SetUpDecimals: decimals, ID: assetType, DataType: pcommon.POINT,
+			RequiredDependencyDataTypes: dependencies, RequiredArgumentTypes: []reflect.Type{reflect.TypeOf(""), reflect.TypeOf("")},
+			Label:       fmt.Sprintf("Script (%d assets)", depCount),
+			Description: "A stateful indicator computed by a sandboxed Starlark script of the scripts directory.",
+			Color:       "#556b2f",
+		}
+		pcommon.AssetTypeMap[string(assetType)] = true
+		INDICATOR_ARGUMENTS[assetType] = IndicatorArguments{
+			Dependencies: dependencySchemas,
+			Arguments: []ArgumentSchema{
+				{Name: "script", Kind: ARGUMENT_KIND_SCRIPT, Description: "The name of the script, without its .star extension."},
+				{Name: "parameters", Kind: ARGUMENT_KIND_STRING, Description: "The comma separated parameters passed to the init function of the script."},
+			},
+		}
+	}
+}
@@ -22,12 +22,15 @@ type AssetState struct {
 	DependenciesRef Dependencies
 }
 
+// Decimals returns -1 (no rounding) if the prices of the set are not known yet.
 func (state *AssetState) Decimals() int8 {
-	if state.SetRef.Settings.IsBinancePair() == nil {
-		return state.config.SetUpDecimals(state.SetRef.CachedTokenAPrice(), state.SetRef.CachedTokenBPrice())
+	if decimals, ok := decimalsFromSettings(state.SetRef.Settings, state.Type()); ok {
+		return decimals
 	}
-	log.Fatal("No decimals set")
-	return -1
+	if !state.SetRef.HasPrices() {
+		return -1
+	}
+	return state.config.SetUpDecimals(state.SetRef.CachedTokenAPrice(), state.SetRef.CachedTokenBPrice())
 }
 
 func (state *AssetState) Settings() pcommon.AssetSettings {
@@ -65,6 +68,26 @@ func (state *AssetState) DataType() pcommon.DataType {
 	return state.config.DataType
 }
 
+// ReadDataType returns the type of the data served to the readers, which differs from the stored one for the assets derived at read time.
+func (state *AssetState) ReadDataType() pcommon.DataType {
+	return ReadDataTypeOf(state.Type())
+}
+
+// ReadList converts the stored ticks read from the DB to the data served to the readers.
+func (state *AssetState) ReadList(list pcommon.DataList) pcommon.DataList {
+	derived, ok := DERIVED_ASSETS[state.Type()]
+	if !ok || derived.Read == nil || list == nil {
+		return list
+	}
+	ret := pcommon.NewTypeTimeArray(derived.ReadType)
+	for _, stored := range list.Map() {
+		if data, ok := derived.Read(stored); ok {
+			ret = ret.Append(data)
+		}
+	}
+	return ret
+}
+
 func (state *AssetState) JSON() (*pcommon.AssetJSON, error) {
 	t0 := state.DataHistoryTime0()
 	consistencies := []pcommon.Consistency{}
@@ -101,7 +124,7 @@ func (state *AssetState) JSON() (*pcommon.AssetJSON, error) {
 		Address:                    addressJSON,
 		ConsistencyMaxLookbackDays: state.consistencyMaxLookbackDays,
 		Consistencies:              consistencies,
-		DataType:                   state.DataType(),
+		DataType:                   state.ReadDataType(),
 		Decimals:                   state.Decimals(),
 		MinDataDate:                state.settings.MinDataDate,
 		LastReadTime:               maxRead,
@@ -137,6 +160,11 @@ func (state *AssetState) IsPoint() bool {
 	return pcommon.DEFAULT_ASSETS[state.settings.Address.AssetType].DataType == pcommon.POINT
 }
 
+// IsComposable returns true if the candles of the asset can be built from the ones of a smaller timeframe without changing the data served to its readers.
+func (state *AssetState) IsComposable() bool {
+	return DERIVED_ASSETS[state.settings.Address.AssetType].Composable
+}
+
 func (state *AssetState) HasDependency(address pcommon.AssetAddress) bool {
 	if !state.ParsedAddress().HasDependencies() {
 		return state.Address() == address
@@ -172,7 +200,7 @@ func (state *AssetState) FillDependencies(activeSets *WorkingSets) error {
 			if set == nil {
 				return fmt.Errorf("set %s not found", setID)
 			}
-			depAsset := set.Assets[dep]
+			depAsset := set.Asset(dep)
 			if depAsset == nil {
 				return fmt.Errorf("asset %s not found", dep)
 			}
@@ -3,6 +3,7 @@ package set2
 import (
 	"bytes"
 	"errors"
+	"pendulev2/util"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v4"
@@ -72,10 +73,7 @@ func (state *AssetState) GetInDataRange(t0, t1 pcommon.TimeUnit, timeframe time.
 		go func() {
 			err := state.onNewRead(timeframe)
 			if err != nil {
-				log.WithFields(log.Fields{
-					"symbol": state.SetRef.ID(),
-					"error":  err.Error(),
-				}).Error("Error setting last read")
+				util.AssetLog(state.Address()).WithField("error", err.Error()).Error("Error setting last read")
 			}
 		}()
 	}
@@ -177,10 +175,7 @@ func (state *AssetState) GetDataLimit(settings DataLimitSettings, recordReading
 		go func() {
 			err := state.onNewRead(timeFrame)
 			if err != nil {
-				log.WithFields(log.Fields{
-					"symbol": state.SetRef.ID(),
-					"error":  err.Error(),
-				}).Error("Error setting last read")
+				util.AssetLog(state.Address()).WithField("error", err.Error()).Error("Error setting last read")
 			}
 		}()
 	}
@@ -3,7 +3,7 @@ package set2
 import (
 	"bytes"
 	"errors"
-	"math"
+	"pendulev2/metrics"
 	"pendulev2/util"
 	"strings"
 	"time"
@@ -48,6 +48,7 @@ func (state *AssetState) Store(data map[pcommon.TimeUnit][]byte, timeframe time.
 				return err
 			}
 		}
+		metrics.RowsStored.WithLabelValues(string(state.Address()), label).Add(float64(len(data)))
 	}
 
 	if err := state.storePrevState(newPrevState, timeframe, newConsistencyTime); err != nil {
@@ -82,17 +83,9 @@ func (state *AssetState) rollback(
 	isRollback := strings.Compare(toDateAsT0, state.Settings().MinDataDate) > 0
 
 	/* Formating t0 */
-	// If the date is a rollback and timeFrame is greater than 1 day, adjust t0 correctly
-	if timeFrame > time.Hour*24 && isRollback {
-		consistencyTime, err := state.GetLastConsistencyTimeCached(timeFrame)
-		if err != nil {
-			return 0, err
-		}
-		diff := consistencyTime - t0
-		cycle := math.Floor(float64(diff) / float64(pcommon.NewTimeUnit(0).Add(timeFrame)))
-
-		//adjusting t0 to the last consistency time if timeFrame is greater than 1 day
-		t0 = consistencyTime.Add(-(timeFrame * time.Duration(cycle)))
+	// If the date is a rollback, adjust t0 to the end of the candle containing the date
+	if timeFrame > pcommon.Env.MIN_TIME_FRAME && isRollback {
+		t0 = state.TimeframeAlignment(timeFrame).CandleEnd(t0.Add(-pcommon.TIME_UNIT_DURATION))
 
 		// If the date is not a rollback, set the t0 to the beginning of the data history
 	} else if !isRollback {
@@ -195,3 +188,174 @@ func (state *AssetState) rollback(
 
 	return totalDeleted, nil
 }
+
+/*
+Patch replaces the data stored on the given timeframe between t0 (included) and t1 (excluded) by the given data.
+Unlike Store, the consistency time is left untouched, so the range must have already been stored.
+The prev state extremes are refreshed if they were pointing at a replaced row.
+*/
+func (state *AssetState) Patch(data map[pcommon.TimeUnit][]byte, timeframe time.Duration, t0, t1 pcommon.TimeUnit) error {
+	consistencyTime, err := state.GetLastConsistencyTimeCached(timeframe)
+	if err != nil {
+		return err
+	}
+	if t1 > state.TimeframeAlignment(timeframe).Next(consistencyTime) {
+		return errors.New("cannot patch data after the last consistency time")
+	}
+
+	label, err := pcommon.Format.TimeFrameToLabel(timeframe)
+	if err != nil {
+		return err
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	txn := state.NewTX(false)
+	iter := txn.NewIterator(opts)
+
+	destructor := util.NewDestructor(state.SetRef.db)
+	limitKey := state.GetDataKey(label, t1)
+	for iter.Seek(state.GetDataKey(label, t0)); iter.Valid(); iter.Next() {
+		currentKey := iter.Item().KeyCopy(nil)
+		if bytes.Compare(currentKey, limitKey) >= 0 {
+			break
+		}
+		if _, _, err := state.ParseDataKey(currentKey); err == nil {
+			destructor.Delete(currentKey)
+		}
+		if destructor.Error() != nil {
+			break
+		}
+	}
+	iter.Close()
+	txn.Discard()
+
+	destructor.Discard()
+	if destructor.Error() != nil {
+		return destructor.Error()
+	}
+
+	if len(data) > 0 {
+		BATCH_SIZE := 10_000
+		i := 0
+		txn := state.NewTX(true)
+		for dataTime, serial := range data {
+			if i == BATCH_SIZE {
+				if err := txn.Commit(); err != nil {
+					return err
+				}
+				txn = state.NewTX(true)
+				i = 0
+			}
+			if err := txn.Set(state.GetDataKey(label, dataTime), serial); err != nil {
+				txn.Discard()
+				return err
+			}
+			i++
+		}
+		if i > 0 {
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+		}
+		metrics.RowsStored.WithLabelValues(string(state.Address()), label).Add(float64(len(data)))
+	}
+
+	return state.refreshPrevStateExtremes(timeframe, t0, t1, data, consistencyTime)
+}
+
+func (state *AssetState) refreshPrevStateExtremes(timeframe time.Duration, t0, t1 pcommon.TimeUnit, data map[pcommon.TimeUnit][]byte, consistencyTime pcommon.TimeUnit) error {
+	prevState, err := state.GetLastPrevStateCached(timeframe)
+	if err != nil {
+		return err
+	}
+	if prevState.IsEmpty() {
+		return nil
+	}
+
+	isReplaced := func(t pcommon.TimeUnit) bool {
+		_, ok := data[t]
+		return t >= t0 && t < t1 && !ok
+	}
+
+	// one of the extremes has been removed, they need to be computed again from the whole history
+	if isReplaced(prevState.minTime) || isReplaced(prevState.maxTime) {
+		newPrevState := NewAssetPrevState()
+		newPrevState.UpdateState(prevState.State())
+		list, err := state.GetInDataRange(0, state.TimeframeAlignment(timeframe).Next(consistencyTime), timeframe, nil, nil, false)
+		if err != nil {
+			return err
+		}
+		for _, tick := range list.Map() {
+			newPrevState.CheckUpdateMin(tick.Min(), tick.GetTime())
+			newPrevState.CheckUpdateMax(tick.Max(), tick.GetTime())
+		}
+		prevState = newPrevState
+	} else {
+		for dataTime, serial := range data {
+			tick, err := pcommon.ParseTypeData(state.DataType(), serial, dataTime)
+			if err != nil {
+				return err
+			}
+			prevState.CheckUpdateMin(tick.Min(), dataTime)
+			prevState.CheckUpdateMax(tick.Max(), dataTime)
+		}
+	}
+
+	return state.storePrevState(prevState, timeframe, consistencyTime)
+}
+
+/*
+DeleteAllData deletes the data, prev states, consistencies, read list and ingestion records of the asset, and frees its address key.
+The asset state must not be used afterwards.
+*/
+func (state *AssetState) DeleteAllData() error {
+	return state.SetRef.deleteAssetData(state.Address(), state.Key())
+}
+
+// DeleteOrphanAssetData deletes the data stored for an address which is not an asset of the set, eg: an asset prepared but never added.
+func (set *Set) DeleteOrphanAssetData(address pcommon.AssetAddress) error {
+	if set.Asset(address) != nil {
+		return util.ErrAlreadyExists
+	}
+	k, err := set.fetchAssetKey(address)
+	if err != nil || k == nil {
+		return err
+	}
+	return set.deleteAssetData(address, *k)
+}
+
+func (set *Set) deleteAssetData(address pcommon.AssetAddress, assetKey [2]byte) error {
+	db := set.db
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, column := range []ColumnType{READ_LIST_COLUMN, LAST_INDEXATION_TIME_COLUMN, INDICATOR_PREV_STATE_COLUMN, INGESTION_RECORD_COLUMN, DATA_COLUMN} {
+		prefix := append(assetKey[:], byte(column))
+		err := db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				if err := wb.Delete(it.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := wb.Delete(set.getAssetKey(address)); err != nil {
+		return err
+	}
+	if err := wb.Delete(set.getAddressKey(assetKey)); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
@@ -36,7 +36,40 @@ func (state *AssetState) ShouldSync() (*string, error) {
 	return nil, nil
 }
 
+// ConsistencyListener is called when the consistency time of an asset on a timeframe moves forward.
+type ConsistencyListener func(asset *AssetState, timeframe time.Duration, consistencyTime pcommon.TimeUnit)
+
+var consistencyListeners []ConsistencyListener
+
+// OnConsistencyAdvance registers a listener called, synchronously, each time the consistency time of an asset moves forward.
+func OnConsistencyAdvance(listener ConsistencyListener) {
+	consistencyListeners = append(consistencyListeners, listener)
+}
+
+/*
+DependenciesAhead returns true if all the dependencies of the asset are consistent beyond the asset on the timeframe,
+so the asset can be indexed further.
+*/
+func (state *AssetState) DependenciesAhead(timeframe time.Duration) (bool, error) {
+	t, err := state.GetLastConsistencyTimeCached(timeframe)
+	if err != nil {
+		return false, err
+	}
+	for _, dep := range state.DependenciesRef {
+		depTime, err := dep.GetLastConsistencyTimeCached(timeframe)
+		if err != nil {
+			return false, err
+		}
+		if depTime <= t {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func (state *AssetState) setNewConsistencyTime(timeframe time.Duration, newLastDataTime pcommon.TimeUnit) error {
+	prevLastDataTime, _ := state.GetLastConsistencyTimeCached(timeframe)
+
 	label, err := pcommon.Format.TimeFrameToLabel(timeframe)
 	if err != nil {
 		return err
@@ -52,6 +85,11 @@ func (state *AssetState) setNewConsistencyTime(timeframe time.Duration, newLastD
 	}
 
 	state.readList.cacheConsistencyUpdate(timeframe, newLastDataTime)
+	if newLastDataTime > prevLastDataTime {
+		for _, listener := range consistencyListeners {
+			listener(state, timeframe, newLastDataTime)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,198 @@
+package set2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type GapReason string
+
+const (
+	GAP_MISSING       GapReason = "MISSING"
+	GAP_EMPTY         GapReason = "EMPTY"
+	GAP_TRUNCATED     GapReason = "TRUNCATED"
+	GAP_LOW_ROW_COUNT GapReason = "LOW_ROW_COUNT"
+)
+
+// IngestionRecord summarizes what has been stored for an asset on a given day by the state parsing.
+type IngestionRecord struct {
+	Date      string           `json:"date"`
+	LineCount int64            `json:"line_count"`
+	RowCount  int64            `json:"row_count"`
+	MinTime   pcommon.TimeUnit `json:"min_time"`
+	MaxTime   pcommon.TimeUnit `json:"max_time"`
+	Checksum  string           `json:"checksum"`
+	ParsedAt  pcommon.TimeUnit `json:"parsed_at"`
+}
+
+type DayGap struct {
+	Date   string           `json:"date"`
+	Reason GapReason        `json:"reason"`
+	Record *IngestionRecord `json:"record"`
+}
+
+func (state *AssetState) StoreIngestionRecord(record IngestionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	txn := state.NewTX(true)
+	defer txn.Discard()
+
+	if err := txn.Set(state.GetIngestionRecordKey(record.Date), data); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+func (state *AssetState) GetIngestionRecord(date string) (*IngestionRecord, error) {
+	txn := state.NewTX(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(state.GetIngestionRecordKey(date))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	record := IngestionRecord{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetIngestionRecords returns the ingestion records between fromDate and toDate (both included) indexed by date.
+func (state *AssetState) GetIngestionRecords(fromDate, toDate string) (map[string]IngestionRecord, error) {
+	txn := state.NewTX(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = state.GetIngestionRecordPrefix()
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+
+	limitKey := state.GetIngestionRecordKey(toDate)
+	ret := map[string]IngestionRecord{}
+	for iter.Seek(state.GetIngestionRecordKey(fromDate)); iter.ValidForPrefix(opts.Prefix); iter.Next() {
+		if bytes.Compare(iter.Item().Key(), limitKey) > 0 {
+			break
+		}
+		data, err := iter.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		record := IngestionRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		ret[record.Date] = record
+	}
+	return ret, nil
+}
+
+// hasDataInRange returns true if at least one row is stored between t0 (included) and t1 (excluded).
+func (state *AssetState) hasDataInRange(t0, t1 pcommon.TimeUnit, timeframe time.Duration, iter *badger.Iterator) (bool, error) {
+	label, err := pcommon.Format.TimeFrameToLabel(timeframe)
+	if err != nil {
+		return false, err
+	}
+	iter.Seek(state.GetDataKey(label, t0))
+	if !iter.Valid() {
+		return false, nil
+	}
+	key := iter.Item().Key()
+	if bytes.Compare(key, state.GetDataKey(label, t1)) >= 0 {
+		return false, nil
+	}
+	_, _, err = state.ParseDataKey(key)
+	return err == nil, nil
+}
+
+/*
+GetGaps lists the missing or suspicious days between fromDate and toDate (both included, formatted as "YYYY-MM-DD").
+The range is clamped to the days already parsed on the minimum timeframe.
+Days parsed before ingestion records existed are only reported if no data is stored for them.
+*/
+func (state *AssetState) GetGaps(fromDate, toDate string) ([]DayGap, error) {
+	if state.ParsedAddress().HasDependencies() {
+		return nil, errors.New("asset is not parsed from archives")
+	}
+
+	consistencyTime, err := state.GetLastConsistencyTimeCached(pcommon.Env.MIN_TIME_FRAME)
+	if err != nil {
+		return nil, err
+	}
+	if consistencyTime == 0 {
+		return []DayGap{}, nil
+	}
+
+	lastParsedDate := pcommon.Format.FormatDateStr(consistencyTime.ToTime().Add(-time.Hour * 24))
+	if fromDate == "" || strings.Compare(fromDate, state.settings.MinDataDate) < 0 {
+		fromDate = state.settings.MinDataDate
+	}
+	if toDate == "" || strings.Compare(toDate, lastParsedDate) > 0 {
+		toDate = lastParsedDate
+	}
+
+	records, err := state.GetIngestionRecords(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rowCounts := []float64{}
+	for _, record := range records {
+		rowCounts = append(rowCounts, float64(record.RowCount))
+	}
+	median := pcommon.Math.SafeMedian(rowCounts)
+
+	t, err := pcommon.Format.StrDateToDate(fromDate)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := state.NewTX(false)
+	defer txn.Discard()
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+
+	gaps := []DayGap{}
+	for date := pcommon.Format.FormatDateStr(t); strings.Compare(date, toDate) <= 0; date = pcommon.Format.FormatDateStr(t) {
+		record, ok := records[date]
+		if !ok {
+			t0 := pcommon.NewTimeUnitFromTime(t)
+			hasData, err := state.hasDataInRange(t0, t0.Add(time.Hour*24), pcommon.Env.MIN_TIME_FRAME, iter)
+			if err != nil {
+				return nil, err
+			}
+			if !hasData {
+				gaps = append(gaps, DayGap{Date: date, Reason: GAP_MISSING})
+			}
+		} else if record.RowCount == 0 {
+			gaps = append(gaps, DayGap{Date: date, Reason: GAP_EMPTY, Record: &record})
+		} else if time.Duration(record.MaxTime-record.MinTime)*pcommon.TIME_UNIT_DURATION < GAP_MIN_DAY_COVERAGE {
+			gaps = append(gaps, DayGap{Date: date, Reason: GAP_TRUNCATED, Record: &record})
+		} else if float64(record.RowCount) < median*GAP_LOW_ROW_COUNT_RATIO {
+			gaps = append(gaps, DayGap{Date: date, Reason: GAP_LOW_ROW_COUNT, Record: &record})
+		}
+		t = t.Add(time.Hour * 24)
+	}
+
+	return gaps, nil
+}
@@ -11,6 +11,7 @@ type ColumnType byte
 const READ_LIST_COLUMN ColumnType = 0
 const LAST_INDEXATION_TIME_COLUMN ColumnType = 1
 const INDICATOR_PREV_STATE_COLUMN ColumnType = 2
+const INGESTION_RECORD_COLUMN ColumnType = 3
 
 const DATA_COLUMN ColumnType = 255
 
@@ -31,6 +32,15 @@ func (sk *AssetState) GetPrevStateKey(timeFrameLabel string, date string) []byte
 	return append(prefix, append([]byte(timeFrameLabel), []byte(date)...)...)
 }
 
+func (sk *AssetState) GetIngestionRecordPrefix() []byte {
+	assetKey := sk.Key()
+	return append(assetKey[:], byte(INGESTION_RECORD_COLUMN))
+}
+
+func (sk *AssetState) GetIngestionRecordKey(date string) []byte {
+	return append(sk.GetIngestionRecordPrefix(), []byte(date)...)
+}
+
 func (sk *AssetState) GetDataKey(timeFrameLabel string, time pcommon.TimeUnit) []byte {
 	assetKey := sk.Key()
 	prefix := append(assetKey[:], byte(DATA_COLUMN))
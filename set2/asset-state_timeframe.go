@@ -37,7 +37,37 @@ func (state *AssetState) IsTimeframeIndexUpToDate(timeFrame time.Duration) (bool
 	if l2 == 0 {
 		return false, nil
 	}
-	return l2.Add(timeFrame) > l1, nil
+	return state.TimeframeAlignment(timeFrame).Next(l2) > l1, nil
+}
+
+/*
+GetTimeframeSource returns the timeframe the candles of the given timeframe are aggregated from:
+the largest active timeframe whose candles nest exactly into the target ones and whose index is up to date,
+or the minimum timeframe if there is none.
+
+Only the composable assets are aggregated from higher timeframes (see DerivedAsset.Composable),
+the averages and medians of the stored units and quantities don't compose, so the other assets are always aggregated from the minimum timeframe.
+*/
+func (state *AssetState) GetTimeframeSource(timeframe time.Duration) (time.Duration, error) {
+	source := pcommon.Env.MIN_TIME_FRAME
+	if !state.IsComposable() {
+		return source, nil
+	}
+
+	target := state.TimeframeAlignment(timeframe)
+	for _, tf := range state.GetActiveTimeFrameList() {
+		if tf <= source || !state.TimeframeAlignment(tf).Divides(target) {
+			continue
+		}
+		upToDate, err := state.IsTimeframeIndexUpToDate(tf)
+		if err != nil {
+			return 0, err
+		}
+		if upToDate {
+			source = tf
+		}
+	}
+	return source, nil
 }
 
 func (state *AssetState) GetLastTimeframeIndexingDate(timeFrame time.Duration) (pcommon.TimeUnit, error) {
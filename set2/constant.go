@@ -1,3 +1,11 @@
 package set2
 
+import "time"
+
 const MAX_CONSISTENCY_DAYS = 3
+
+// a parsed day whose ticks span less than this duration is reported as truncated
+const GAP_MIN_DAY_COVERAGE = 20 * time.Hour
+
+// a parsed day with less rows than this ratio of the median row count of the scanned days is reported as suspicious
+const GAP_LOW_ROW_COUNT_RATIO = 0.1
@@ -0,0 +1,194 @@
+package set2
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// DependencyGraph links the assets of all the working sets to the assets computed from them, across sets.
+type DependencyGraph struct {
+	assets     map[pcommon.AssetAddress]*AssetState
+	dependents map[pcommon.AssetAddress][]pcommon.AssetAddress
+}
+
+// the graph of the working sets, built on first use and dropped each time an asset or a set is added or removed
+var cachedGraph struct {
+	mu         sync.Mutex
+	graph      *DependencyGraph
+	generation uint64
+}
+
+func invalidateDependencyGraph() {
+	cachedGraph.mu.Lock()
+	cachedGraph.graph = nil
+	cachedGraph.generation++
+	cachedGraph.mu.Unlock()
+}
+
+/*
+DependencyGraph returns the dependency graph of the assets of all the working sets, the dependencies not found in the working sets are ignored.
+The graph is shared until the assets change, it must not be modified.
+*/
+func (s *WorkingSets) DependencyGraph() *DependencyGraph {
+	cachedGraph.mu.Lock()
+	g, generation := cachedGraph.graph, cachedGraph.generation
+	cachedGraph.mu.Unlock()
+	if g != nil {
+		return g
+	}
+
+	//built without the lock of the cache, the assets of each set being copied under the lock of the set
+	g = s.buildDependencyGraph()
+	cachedGraph.mu.Lock()
+	if cachedGraph.generation == generation {
+		cachedGraph.graph = g
+	}
+	cachedGraph.mu.Unlock()
+	return g
+}
+
+func (s *WorkingSets) buildDependencyGraph() *DependencyGraph {
+	g := &DependencyGraph{
+		assets:     make(map[pcommon.AssetAddress]*AssetState),
+		dependents: make(map[pcommon.AssetAddress][]pcommon.AssetAddress),
+	}
+	for _, set := range s.Range() {
+		for _, asset := range set.AssetList() {
+			g.assets[asset.Address()] = asset
+		}
+	}
+	for address, asset := range g.assets {
+		for _, dep := range asset.ParsedAddress().Dependencies {
+			if _, ok := g.assets[dep]; ok {
+				g.dependents[dep] = append(g.dependents[dep], address)
+			}
+		}
+	}
+	for _, list := range g.dependents {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i] < list[j]
+		})
+	}
+	return g
+}
+
+// Dependents returns the assets having the given address as direct dependency.
+func (g *DependencyGraph) Dependents(address pcommon.AssetAddress) []*AssetState {
+	list := []*AssetState{}
+	for _, dependent := range g.dependents[address] {
+		list = append(list, g.assets[dependent])
+	}
+	return list
+}
+
+/*
+TopologicalOrder returns all the assets of the graph, each asset coming after its dependencies.
+The assets are sorted by address among the ones whose dependencies are all listed, so the order is stable.
+*/
+func (g *DependencyGraph) TopologicalOrder() ([]*AssetState, error) {
+	remaining := make(map[pcommon.AssetAddress]int, len(g.assets))
+	ready := []pcommon.AssetAddress{}
+	for address, asset := range g.assets {
+		count := 0
+		for _, dep := range asset.ParsedAddress().Dependencies {
+			if _, ok := g.assets[dep]; ok {
+				count++
+			}
+		}
+		remaining[address] = count
+		if count == 0 {
+			ready = append(ready, address)
+		}
+	}
+
+	order := make([]*AssetState, 0, len(g.assets))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i] < ready[j]
+		})
+		address := ready[0]
+		ready = ready[1:]
+		order = append(order, g.assets[address])
+
+		for _, dependent := range g.dependents[address] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != len(g.assets) {
+		return order, fmt.Errorf("dependency cycle between %d assets", len(g.assets)-len(order))
+	}
+	return order, nil
+}
+
+// DependencyEdge links a dependency to an asset computed from it.
+type DependencyEdge struct {
+	From pcommon.AssetAddress `json:"from"`
+	To   pcommon.AssetAddress `json:"to"`
+}
+
+// Assets returns all the assets of the graph sorted by address.
+func (g *DependencyGraph) Assets() []*AssetState {
+	list := make([]*AssetState, 0, len(g.assets))
+	for _, asset := range g.assets {
+		list = append(list, asset)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address() < list[j].Address()
+	})
+	return list
+}
+
+// Edges returns all the dependency links of the graph sorted by dependency then dependent.
+func (g *DependencyGraph) Edges() []DependencyEdge {
+	edges := []DependencyEdge{}
+	for from, dependents := range g.dependents {
+		for _, to := range dependents {
+			edges = append(edges, DependencyEdge{From: from, To: to})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+/*
+Impact returns the asset of the given address followed by all the assets computed from it, directly or not,
+each asset coming after its dependencies. It is empty if the asset is not in the graph.
+*/
+func (g *DependencyGraph) Impact(address pcommon.AssetAddress) []*AssetState {
+	if _, ok := g.assets[address]; !ok {
+		return []*AssetState{}
+	}
+
+	//depth first post order, reversed
+	visited := map[pcommon.AssetAddress]bool{}
+	order := []*AssetState{}
+	var visit func(address pcommon.AssetAddress)
+	visit = func(address pcommon.AssetAddress) {
+		if visited[address] {
+			return
+		}
+		visited[address] = true
+		for _, dependent := range g.dependents[address] {
+			visit(dependent)
+		}
+		order = append(order, g.assets[address])
+	}
+	visit(address)
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
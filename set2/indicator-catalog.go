@@ -0,0 +1,253 @@
+package set2
+
+import (
+	"fmt"
+	"pendulev2/formula"
+	"pendulev2/script"
+	"sort"
+	"strconv"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+const (
+	ARGUMENT_KIND_INT    = "int"
+	ARGUMENT_KIND_FLOAT  = "float"
+	ARGUMENT_KIND_BOOL   = "bool"
+	ARGUMENT_KIND_STRING = "string"
+	// the argument is the name of a column of the dependency at index ColumnOf
+	ARGUMENT_KIND_COLUMN = "column"
+	// the argument is an expression over the dependencies (see the formula package)
+	ARGUMENT_KIND_FORMULA = "formula"
+	// the argument is the name of a script of the scripts directory (see the script package)
+	ARGUMENT_KIND_SCRIPT = "script"
+)
+
+type ArgumentSchema struct {
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	// MinExclusive is true if the argument must be strictly greater than Min
+	MinExclusive bool `json:"min_exclusive,omitempty"`
+	ColumnOf     int  `json:"column_of,omitempty"`
+}
+
+type DependencySchema struct {
+	Name string `json:"name"`
+	// DataType is -1 if the dependency can be of any data type
+	DataType     pcommon.DataType `json:"data_type"`
+	DataTypeName string           `json:"data_type_name"`
+}
+
+type IndicatorSchema struct {
+	AssetType    pcommon.AssetType    `json:"asset_type"`
+	Label        string               `json:"label"`
+	Description  string               `json:"description"`
+	Color        string               `json:"color"`
+	DataType     pcommon.DataType     `json:"data_type"`
+	DataTypeName string               `json:"data_type_name"`
+	Columns      []pcommon.ColumnName `json:"columns"`
+	Dependencies []DependencySchema   `json:"dependencies"`
+	Arguments    []ArgumentSchema     `json:"arguments"`
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+var periodArgument = ArgumentSchema{Name: "period", Kind: ARGUMENT_KIND_INT, Description: "The number of candles of the period.", Min: bound(1), Max: bound(10_000)}
+var columnArgument = ArgumentSchema{Name: "column", Kind: ARGUMENT_KIND_COLUMN, Description: "The column of the source the indicator is computed on.", ColumnOf: 0}
+var anySource = DependencySchema{Name: "source", DataType: -1}
+
+type IndicatorArguments struct {
+	Dependencies []DependencySchema
+	Arguments    []ArgumentSchema
+}
+
+// INDICATOR_ARGUMENTS names the dependencies and arguments of the assets computed from other assets.
+var INDICATOR_ARGUMENTS = map[pcommon.AssetType]IndicatorArguments{
+	pcommon.Asset.RSI:  {[]DependencySchema{{Name: "price", DataType: pcommon.UNIT}}, []ArgumentSchema{periodArgument}},
+	pcommon.Asset.RSI2: {[]DependencySchema{anySource}, []ArgumentSchema{columnArgument, periodArgument}},
+	pcommon.Asset.SMA:  {[]DependencySchema{anySource}, []ArgumentSchema{columnArgument, periodArgument}},
+	pcommon.Asset.EMA:  {[]DependencySchema{anySource}, []ArgumentSchema{columnArgument, periodArgument}},
+	pcommon.Asset.WMA:  {[]DependencySchema{anySource}, []ArgumentSchema{columnArgument, periodArgument}},
+	pcommon.Asset.HMA:  {[]DependencySchema{anySource}, []ArgumentSchema{columnArgument, periodArgument}},
+}
+
+func dataTypeName(dataType pcommon.DataType) string {
+	if dataType == -1 {
+		return ""
+	}
+	return dataType.String()
+}
+
+func argumentKind(config pcommon.AssetStateConfig, i int) string {
+	t := config.RequiredArgumentTypes[i].String()
+	switch {
+	case strings.HasPrefix(t, "int"):
+		return ARGUMENT_KIND_INT
+	case strings.HasPrefix(t, "float"):
+		return ARGUMENT_KIND_FLOAT
+	case strings.HasPrefix(t, "bool"):
+		return ARGUMENT_KIND_BOOL
+	}
+	return ARGUMENT_KIND_STRING
+}
+
+// GetIndicatorSchema returns the schema of an asset computed from other assets, the names default to their position if not documented.
+func GetIndicatorSchema(assetType pcommon.AssetType) (*IndicatorSchema, bool) {
+	config, ok := pcommon.DEFAULT_ASSETS[assetType]
+	if !ok || len(config.RequiredDependencyDataTypes) == 0 {
+		return nil, false
+	}
+	documented := INDICATOR_ARGUMENTS[assetType]
+
+	schema := &IndicatorSchema{
+		AssetType:    assetType,
+		Label:        config.Label,
+		Description:  config.Description,
+		Color:        config.Color,
+		DataType:     config.DataType,
+		DataTypeName: dataTypeName(config.DataType),
+		Columns:      config.DataType.Columns(),
+	}
+	for i, dataType := range config.RequiredDependencyDataTypes {
+		dep := DependencySchema{Name: fmt.Sprintf("dependency_%d", i)}
+		if i < len(documented.Dependencies) {
+			dep = documented.Dependencies[i]
+		}
+		dep.DataType = dataType
+		dep.DataTypeName = dataTypeName(dataType)
+		schema.Dependencies = append(schema.Dependencies, dep)
+	}
+	for i := range config.RequiredArgumentTypes {
+		arg := ArgumentSchema{Name: fmt.Sprintf("argument_%d", i), Kind: argumentKind(config, i)}
+		if i < len(documented.Arguments) {
+			arg = documented.Arguments[i]
+		}
+		schema.Arguments = append(schema.Arguments, arg)
+	}
+	return schema, true
+}
+
+// IndicatorCatalog returns the schemas of all the assets computed from other assets, sorted by asset type.
+func IndicatorCatalog() []IndicatorSchema {
+	catalog := []IndicatorSchema{}
+	for assetType := range pcommon.DEFAULT_ASSETS {
+		if schema, ok := GetIndicatorSchema(assetType); ok {
+			catalog = append(catalog, *schema)
+		}
+	}
+	sort.Slice(catalog, func(i, j int) bool {
+		return catalog[i].AssetType < catalog[j].AssetType
+	})
+	return catalog
+}
+
+// validate checks an argument against its schema, deps are the data types of the parsed dependencies.
+func (arg ArgumentSchema) validate(value string, deps []pcommon.DataType) error {
+	var number float64
+	switch arg.Kind {
+	case ARGUMENT_KIND_INT:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		number = float64(v)
+	case ARGUMENT_KIND_FLOAT:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		number = v
+	case ARGUMENT_KIND_BOOL:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		return nil
+	case ARGUMENT_KIND_COLUMN:
+		//the dependency is invalid, it is already reported
+		if arg.ColumnOf >= len(deps) || deps[arg.ColumnOf] == 0 {
+			return nil
+		}
+		columns := lo.Without(deps[arg.ColumnOf].Columns(), pcommon.ColumnType.TIME)
+		if !lo.Contains(columns, pcommon.ColumnName(value)) {
+			return fmt.Errorf("%q is not a column of the dependency, expected one of %v", value, columns)
+		}
+		return nil
+	case ARGUMENT_KIND_FORMULA:
+		_, err := formula.Parse(value, len(deps), deps)
+		return err
+	case ARGUMENT_KIND_SCRIPT:
+		return script.Check(value)
+	default:
+		return nil
+	}
+
+	if arg.Min != nil && (number < *arg.Min || (arg.MinExclusive && number == *arg.Min)) {
+		if arg.MinExclusive {
+			return fmt.Errorf("%v must be greater than %v", number, *arg.Min)
+		}
+		return fmt.Errorf("%v must be greater or equal to %v", number, *arg.Min)
+	}
+	if arg.Max != nil && number > *arg.Max {
+		return fmt.Errorf("%v must be lower or equal to %v", number, *arg.Max)
+	}
+	return nil
+}
+
+/*
+ValidateIndicatorAddress checks the dependencies and arguments of an asset computed from other assets against its schema.
+The returned error lists every invalid dependency and argument.
+*/
+func ValidateIndicatorAddress(address pcommon.AssetAddressParsed) error {
+	schema, ok := GetIndicatorSchema(address.AssetType)
+	if !ok {
+		return nil
+	}
+
+	errs := []string{}
+	if len(address.Dependencies) != len(schema.Dependencies) {
+		errs = append(errs, fmt.Sprintf("expected %d dependencies, got %d", len(schema.Dependencies), len(address.Dependencies)))
+	}
+	if len(address.Arguments) != len(schema.Arguments) {
+		errs = append(errs, fmt.Sprintf("expected %d arguments, got %d", len(schema.Arguments), len(address.Arguments)))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %s: %s", address.AssetType, strings.Join(errs, "; "))
+	}
+
+	depTypes := make([]pcommon.DataType, len(address.Dependencies))
+	for i, depAddress := range address.Dependencies {
+		dep := schema.Dependencies[i]
+		parsed, err := depAddress.Parse()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("dependency %s: %s", dep.Name, err))
+			continue
+		}
+		if _, ok := pcommon.DEFAULT_ASSETS[parsed.AssetType]; !ok {
+			errs = append(errs, fmt.Sprintf("dependency %s: unknown asset type %s", dep.Name, parsed.AssetType))
+			continue
+		}
+		depTypes[i] = ReadDataTypeOf(parsed.AssetType)
+		if dep.DataType > 0 && depTypes[i] != dep.DataType {
+			errs = append(errs, fmt.Sprintf("dependency %s: expected %s data, got %s (%s)", dep.Name, dep.DataTypeName, depTypes[i].String(), parsed.AssetType))
+		}
+	}
+
+	for i, value := range address.Arguments {
+		arg := schema.Arguments[i]
+		if err := arg.validate(value, depTypes); err != nil {
+			errs = append(errs, fmt.Sprintf("argument %s: %s", arg.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %s: %s", address.AssetType, strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"pendulev2/exchange"
 	"pendulev2/util"
+	"sort"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	pcommon "github.com/pendulea/pendule-common"
@@ -23,7 +25,8 @@ const TOKEN_B_PRICE_KEY = "tokenBPrice"
 
 type Set struct {
 	initialized bool
-	Assets      map[pcommon.AssetAddress]*AssetState
+	assetsMu    sync.RWMutex //guards assets, and the assets of Settings when they change
+	assets      map[pcommon.AssetAddress]*AssetState
 	Settings    pcommon.SetSettings
 	db          *badger.DB
 	cancels     []context.CancelFunc
@@ -31,7 +34,7 @@ type Set struct {
 }
 
 func (set *Set) JSON() (*pcommon.SetJSON, error) {
-	t, err := set.Settings.GetSetType()
+	adapter, err := exchange.FromSettings(set.Settings)
 	if err != nil {
 		return nil, err
 	}
@@ -40,10 +43,10 @@ func (set *Set) JSON() (*pcommon.SetJSON, error) {
 		Settings: set.Settings,
 		Size:     set.Size(),
 		Assets:   make([]pcommon.AssetJSON, 0),
-		Type:     t,
+		Type:     adapter.SetType(),
 	}
 
-	for _, asset := range set.Assets {
+	for _, asset := range set.AssetList() {
 		j, err := asset.JSON()
 		if err != nil {
 			return nil, err
@@ -58,6 +61,16 @@ func (set *Set) Size() int64 {
 	return lsm + vlog
 }
 
+// IsOpen returns true if the database of the set is open.
+func (set *Set) IsOpen() bool {
+	return set.db != nil && !set.db.IsClosed()
+}
+
+// DBSize returns the size of the LSM tree and of the value log of the database.
+func (set *Set) DBSize() (lsm int64, vlog int64) {
+	return set.db.Size()
+}
+
 func (set *Set) RunValueLogGC() {
 	for {
 		err := set.db.RunValueLogGC(0.5)
@@ -91,35 +104,14 @@ func NewSet(settings pcommon.SetSettings) (*Set, error) {
 		return nil, err
 	}
 
+	adapter, err := exchange.FromSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
 	//if the database does not exist
 	if len(listFiles) == 0 {
-
 		firstInstance = true
-		//if the set is a binance pair
-		if settings.IsBinancePair() == nil {
-			symbol0 := strings.ToUpper(settings.ID[0])
-			symbol1 := strings.ToUpper(settings.ID[1])
-
-			//get the price of the first token
-			price, err := util.GetPairPrice(symbol0+"USDT", true)
-			if err != nil {
-				return nil, err
-			}
-			if price == 0.00 {
-				return nil, errors.New("price is 0")
-			}
-			tokenAPrice = price
-			//get the price of the second token if it is not a stable coin
-			if !strings.Contains(symbol1, "USD") {
-				price, err := util.GetPairPrice(symbol1+"USDT", true)
-				if err != nil {
-					return nil, err
-				}
-				tokenBPrice = price
-			} else {
-				tokenBPrice = 1.00
-			}
-		}
 	}
 
 	options := badger.DefaultOptions(dbPath).WithLoggingLevel(badger.ERROR)
@@ -132,32 +124,44 @@ func NewSet(settings pcommon.SetSettings) (*Set, error) {
 		db:       db,
 		Settings: settings,
 		cancels:  make([]context.CancelFunc, 0),
-		Assets:   make(map[pcommon.AssetAddress]*AssetState),
+		assets:   make(map[pcommon.AssetAddress]*AssetState),
 		cache:    make(map[string]interface{}),
 	}
 
-	if set.Settings.IsBinancePair() == nil {
-		if firstInstance {
-			if err := set.storePrices(tokenAPrice, tokenBPrice); err != nil {
-				return nil, err
-			}
-		} else {
-			tokenAPrice, tokenBPrice, err = set.getPrices()
-			if err != nil {
-				return nil, err
-			}
+	if firstInstance {
+		tokenAPrice, tokenBPrice, err = fetchPrices(settings, adapter)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				util.LOG_FIELD_SET: id,
+				"error":            err.Error(),
+			}).Warn("prices unavailable, they will be set from the first parsed price archive")
+		} else if err := set.storePrices(tokenAPrice, tokenBPrice); err != nil {
+			return nil, err
+		}
+	} else {
+		tokenAPrice, tokenBPrice, err = set.getPrices()
+		if err != nil && err != badger.ErrKeyNotFound {
+			return nil, err
 		}
 	}
 
 	for _, assetSettings := range settings.Assets {
+		//a stored asset failing to load is skipped, it stays in the settings to be loaded again once fixed
+		logger := util.AssetLog(assetSettings.Address.AddSetID(settings.ID).BuildAddress())
+		if err := set.ValidateAssetRules(assetSettings); err != nil {
+			logger.WithField("error", err.Error()).Warn("stored asset does not follow the current rules of its type")
+		}
 		if err := set.AddAsset(assetSettings); err != nil {
-			fmt.Println(err)
-			return nil, err
+			logger.WithField("error", err.Error()).Error("stored asset not loaded")
 		}
 	}
 
+	if err := set.migrateAlignment(firstInstance); err != nil {
+		return nil, err
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"symbol":           id,
+		util.LOG_FIELD_SET: id,
 		"assets":           len(settings.Settings),
 		set.Settings.ID[0]: strconv.FormatFloat(tokenAPrice, 'f', -1, 64) + "$",
 		set.Settings.ID[1]: strconv.FormatFloat(tokenBPrice, 'f', -1, 64) + "$",
@@ -174,25 +178,47 @@ func (s *Set) Close() {
 
 	if s.db != nil {
 		logrus.WithFields(logrus.Fields{
-			"symbol": s.ID(),
+			util.LOG_FIELD_SET: s.ID(),
 		}).Warn("Closing DB...")
 		if err := s.db.Close(); err != nil {
 			logrus.WithFields(logrus.Fields{
-				"symbol": s.ID(),
-				"msg":    err.Error(),
+				util.LOG_FIELD_SET: s.ID(),
+				"msg":              err.Error(),
 			}).Error("Error closing database connection")
 		}
 	}
 }
 
+// Asset returns the asset of the set having the given address, nil if there is none.
+func (set *Set) Asset(address pcommon.AssetAddress) *AssetState {
+	set.assetsMu.RLock()
+	defer set.assetsMu.RUnlock()
+	return set.assets[address]
+}
+
+// AssetList returns a copy of the list of the assets of the set sorted by address, which can be iterated while assets are added or removed.
+func (set *Set) AssetList() []*AssetState {
+	set.assetsMu.RLock()
+	list := make([]*AssetState, 0, len(set.assets))
+	for _, asset := range set.assets {
+		list = append(list, asset)
+	}
+	set.assetsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address() < list[j].Address()
+	})
+	return list
+}
+
 func (s *Set) AddTimeframe(timeframe time.Duration, engineCB func(state *AssetState, timeframe time.Duration) error) {
-	for _, asset := range s.Assets {
+	for _, asset := range s.AssetList() {
 		engineCB(asset, timeframe)
 	}
 }
 
 func (s *Set) RemoveTimeframe(timeframe time.Duration, engineCB func(state *AssetState, timeframe time.Duration) error) {
-	for _, asset := range s.Assets {
+	for _, asset := range s.AssetList() {
 		engineCB(asset, timeframe)
 	}
 }
@@ -202,47 +228,176 @@ func (s *Set) AddCancelFunc(cancel context.CancelFunc) {
 }
 
 func (set *Set) AddAsset(newAsset pcommon.AssetSettings) error {
-	if err := newAsset.IsValid(set.Settings); err != nil {
+	state, settingsCopy, err := set.prepareAsset(newAsset)
+	if err != nil {
+		return err
+	}
+	set.assetsMu.Lock()
+	//the sources may have been removed since the asset was prepared
+	if err := set.checkDerivedSources(newAsset); err != nil {
+		set.assetsMu.Unlock()
+		return err
+	}
+	set.assets[state.Address()] = state
+	if set.initialized {
+		set.Settings = *settingsCopy
+	}
+	set.assetsMu.Unlock()
+	invalidateDependencyGraph()
+	return nil
+}
+
+// checkDerivedSources returns an error if the asset is derived and one of its sources is not in the settings of the set.
+func (set *Set) checkDerivedSources(newAsset pcommon.AssetSettings) error {
+	if derived, ok := DERIVED_ASSETS[newAsset.Address.AssetType]; ok {
+		for _, source := range derived.Sources {
+			sourceAddress := pcommon.AssetAddressParsed{SetID: set.Settings.ID, AssetType: source}.BuildAddress()
+			if !set.Settings.ContainsAssetAddress(sourceAddress) {
+				return fmt.Errorf("derived asset requires %s to be in the set", source)
+			}
+		}
+	}
+	return nil
+}
+
+// PrepareAsset builds the state of a new asset without adding it to the set, so it can be indexed before being swapped in with SwapAsset.
+func (set *Set) PrepareAsset(newAsset pcommon.AssetSettings) (*AssetState, error) {
+	address := newAsset.Address.AddSetID(set.Settings.ID).BuildAddress()
+	if set.Asset(address) != nil {
+		return nil, util.ErrAlreadyExists
+	}
+	if err := set.ValidateAssetRules(newAsset); err != nil {
+		return nil, err
+	}
+	state, _, err := set.prepareAsset(newAsset)
+	return state, err
+}
+
+/*
+ValidateAssetRules checks the arguments and dependencies of a new asset against the current rules of its type.
+The rules are only enforced when an asset is added, the stored assets are loaded even if a rule got stricter since.
+*/
+func (set *Set) ValidateAssetRules(newAsset pcommon.AssetSettings) error {
+	if err := ValidateIndicatorAddress(newAsset.Address.AddSetID(set.Settings.ID)); err != nil {
 		return err
 	}
+	if derived, ok := DERIVED_ASSETS[newAsset.Address.AssetType]; ok && derived.ValidateArguments != nil {
+		return derived.ValidateArguments(newAsset.Address.Arguments)
+	}
+	return nil
+}
+
+// prepareAsset validates a new asset and allocates its key, it returns its state and the settings of the set including it.
+func (set *Set) prepareAsset(newAsset pcommon.AssetSettings) (*AssetState, *pcommon.SetSettings, error) {
+	if err := newAsset.IsValid(set.Settings); err != nil {
+		return nil, nil, err
+	}
 
 	settingsCopy := set.Settings.Copy()
 	if set.initialized {
-		setTypeBefore, err := set.Settings.GetSetType()
+		adapter, err := exchange.FromSettings(set.Settings)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		settingsCopy.Assets = append(settingsCopy.Assets, newAsset)
-		setTypeAfter, err := settingsCopy.GetSetType()
-		if err != nil {
-			return err
-		}
-		if setTypeAfter != setTypeBefore {
-			return errors.New("asset type is not supported by set")
+		if adapter.ValidateSettings(LibrarySettings(*settingsCopy)) != nil {
+			return nil, nil, errors.New("asset type is not supported by set")
 		}
 	}
 
+	if err := set.checkDerivedSources(newAsset); err != nil {
+		return nil, nil, err
+	}
+
 	address := newAsset.Address.AddSetID(set.Settings.ID).BuildAddress()
 	k, err := set.fetchAssetKey(address)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if k == nil {
 		k, err = set.newAddressKey()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		if err := set.storeAddressKey(address, *k); err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 	assetConfig := pcommon.DEFAULT_ASSETS[newAsset.Address.AssetType]
-	set.Assets[address] = NewAssetState(assetConfig, newAsset, set, k)
-	if set.initialized {
-		set.Settings = *settingsCopy
+	return NewAssetState(assetConfig, newAsset, set, k), settingsCopy, nil
+}
+
+// SwapAsset replaces an asset of the set by a prepared one, at the same position in the settings.
+func (set *Set) SwapAsset(oldAddress pcommon.AssetAddress, newAsset *AssetState) error {
+	set.assetsMu.Lock()
+	defer set.assetsMu.Unlock()
+	if set.assets[oldAddress] == nil {
+		return util.ErrAssetNotFound
+	}
+	if err := set.checkDerivedSources(newAsset.settings); err != nil {
+		return err
+	}
+
+	settingsCopy := set.Settings.Copy()
+	for i, asset := range settingsCopy.Assets {
+		if asset.Address.AddSetID(set.Settings.ID).BuildAddress() == oldAddress {
+			settingsCopy.Assets[i] = newAsset.settings
+		}
+	}
+
+	delete(set.assets, oldAddress)
+	set.assets[newAsset.Address()] = newAsset
+	set.Settings = *settingsCopy
+	invalidateDependencyGraph()
+	return nil
+}
+
+// CheckAssetRemoval returns an error if the asset can't be removed from the set, the assets derived from it requiring it.
+func (set *Set) CheckAssetRemoval(address pcommon.AssetAddress) error {
+	set.assetsMu.RLock()
+	defer set.assetsMu.RUnlock()
+	return set.checkAssetRemoval(address)
+}
+
+func (set *Set) checkAssetRemoval(address pcommon.AssetAddress) error {
+	asset := set.assets[address]
+	if asset == nil {
+		return util.ErrAssetNotFound
+	}
+	for _, sibling := range set.assets {
+		if derived, ok := DERIVED_ASSETS[sibling.Type()]; ok && lo.Contains(derived.Sources, asset.Type()) {
+			return fmt.Errorf("asset %s is a source of %s", address, sibling.Address())
+		}
 	}
+	return nil
+}
+
+/*
+RemoveAsset removes an asset from the set and its settings, its data is left untouched.
+The removal is checked (see CheckAssetRemoval), then check is called with the asset, both under the lock of the assets,
+so no asset derived from it can be added between the checks and the removal.
+*/
+func (set *Set) RemoveAsset(address pcommon.AssetAddress, check func(asset *AssetState) error) error {
+	set.assetsMu.Lock()
+	defer set.assetsMu.Unlock()
+	if err := set.checkAssetRemoval(address); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(set.assets[address]); err != nil {
+			return err
+		}
+	}
+
+	settingsCopy := set.Settings.Copy()
+	settingsCopy.Assets = lo.Filter(settingsCopy.Assets, func(a pcommon.AssetSettings, _ int) bool {
+		return a.Address.AddSetID(set.Settings.ID).BuildAddress() != address
+	})
 
+	delete(set.assets, address)
+	set.Settings = *settingsCopy
+	invalidateDependencyGraph()
 	return nil
 }
 
@@ -370,7 +525,7 @@ Main:
 func (s *Set) GetAllAssetsTimeframes() []time.Duration {
 	ret := []time.Duration{}
 
-	for _, asset := range s.Assets {
+	for _, asset := range s.AssetList() {
 		ret = append(asset.GetActiveTimeFrameList(), ret...)
 	}
 
@@ -17,3 +17,7 @@ func (set *Set) getAssetKey(address pcommon.AssetAddress) []byte {
 func (set *Set) getPricesKey() []byte {
 	return []byte("prices")
 }
+
+func (set *Set) getAlignmentVersionKey() []byte {
+	return []byte("alignment_version")
+}
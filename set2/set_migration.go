@@ -0,0 +1,90 @@
+package set2
+
+import (
+	"encoding/binary"
+	"pendulev2/util"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// ALIGNMENT_VERSION is bumped each time the candle boundaries of already indexed timeframes change.
+const ALIGNMENT_VERSION = 1
+
+/*
+alignmentChanged returns true if the candles of a timeframe indexed with the given alignment version have other boundaries now.
+Before the version 1 the candles followed each other from the first one without calendar, so only the timeframes dividing a day
+(anchored on the midnight of the first day) and the week (starting on monday) kept their boundaries.
+*/
+func alignmentChanged(version uint64, timeframe time.Duration) bool {
+	if version >= ALIGNMENT_VERSION {
+		return false
+	}
+	return pcommon.DAY%timeframe != 0 && timeframe != pcommon.WEEK
+}
+
+func (set *Set) getAlignmentVersion() (uint64, error) {
+	txn := set.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(set.getAlignmentVersionKey())
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var version uint64
+	err = item.Value(func(val []byte) error {
+		version = binary.BigEndian.Uint64(val)
+		return nil
+	})
+	return version, err
+}
+
+func (set *Set) storeAlignmentVersion() error {
+	txn := set.db.NewTransaction(true)
+	defer txn.Discard()
+
+	version := make([]byte, 8)
+	binary.BigEndian.PutUint64(version, ALIGNMENT_VERSION)
+	if err := txn.Set(set.getAlignmentVersionKey(), version); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+/*
+migrateAlignment drops the candles of the timeframes whose boundaries changed since they were indexed,
+the timeframes are kept active so they are reindexed with the current alignment by the next asset tasks.
+*/
+func (set *Set) migrateAlignment(firstInstance bool) error {
+	version := uint64(ALIGNMENT_VERSION)
+	if !firstInstance {
+		var err error
+		if version, err = set.getAlignmentVersion(); err != nil {
+			return err
+		}
+	}
+	if version >= ALIGNMENT_VERSION {
+		return set.storeAlignmentVersion()
+	}
+
+	for _, asset := range set.AssetList() {
+		for _, timeframe := range asset.GetActiveTimeFrameList() {
+			if timeframe == pcommon.Env.MIN_TIME_FRAME || !alignmentChanged(version, timeframe) {
+				continue
+			}
+			if _, err := asset.rollback(timeframe, asset.Settings().MinDataDate, nil); err != nil {
+				return err
+			}
+			if err := asset.AddIfUnfoundInReadList(timeframe); err != nil {
+				return err
+			}
+			label, _ := pcommon.Format.TimeFrameToLabel(timeframe)
+			util.AssetLog(asset.Address()).WithField(util.LOG_FIELD_TIMEFRAME, label).Warn("timeframe dropped to be reindexed with the calendar alignment")
+		}
+	}
+	return set.storeAlignmentVersion()
+}
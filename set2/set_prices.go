@@ -0,0 +1,178 @@
+package set2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"pendulev2/exchange"
+	"strconv"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+/*
+Prices and decimals can be supplied in the set settings to run without any network access:
+  - price_a / price_b: the USD price of each token as a scaled decimal, the mantissa being divided by 10^price_<a|b>_scale
+  - decimals_<asset type>: the number of decimals stored for an asset type
+*/
+const (
+	PRICE_A_SETTING_KEY     = "price_a"
+	PRICE_B_SETTING_KEY     = "price_b"
+	PRICE_SCALE_SUFFIX      = "_scale"
+	DECIMALS_SETTING_PREFIX = "decimals_"
+
+	// significant digits kept by the scaled price settings
+	PRICE_SETTING_DIGITS = 15
+)
+
+// PRICE_ASSETS are the assets whose values are the price of the token A in token B, the first one parsed bootstraps the prices of a set.
+var PRICE_ASSETS = []pcommon.AssetType{
+	pcommon.Asset.FUTURES_PRICE, pcommon.Asset.SPOT_PRICE,
+	BOOK_MID_PRICE,
+}
+
+var ErrPricesUnknown = errors.New("prices unknown")
+
+func IsPriceAsset(assetType pcommon.AssetType) bool {
+	return lo.IndexOf(PRICE_ASSETS, assetType) != -1
+}
+
+func priceFromSettings(settings pcommon.SetSettings, key string) (float64, bool) {
+	value, ok := settings.Settings[key]
+	if !ok || value <= 0 {
+		return 0, false
+	}
+	return float64(value) / math.Pow10(int(settings.Settings[key+PRICE_SCALE_SUFFIX])), true
+}
+
+// SetPriceSetting stores a USD price in the settings as a scaled decimal, keeping its significant digits whatever its magnitude.
+func SetPriceSetting(settings *pcommon.SetSettings, key string, price float64) error {
+	if price <= 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+		return errors.New("price must be greater than 0")
+	}
+	//eg: 1.2e-08 -> 1.20000000000000e-08 -> mantissa 12, scale 9 once the trailing zeros are trimmed
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(price, 'e', PRICE_SETTING_DIGITS-1, 64), "e")
+	mantissa = strings.Replace(mantissa, ".", "", 1)
+	exp, err := strconv.Atoi(exponent)
+	if err != nil {
+		return err
+	}
+	scale := PRICE_SETTING_DIGITS - 1 - exp
+	for strings.HasSuffix(mantissa, "0") {
+		mantissa = strings.TrimSuffix(mantissa, "0")
+		scale--
+	}
+	value, err := strconv.ParseInt(mantissa, 10, 64)
+	if err != nil {
+		return err
+	}
+	settings.Settings[key] = value
+	settings.Settings[key+PRICE_SCALE_SUFFIX] = int64(scale)
+	return nil
+}
+
+func decimalsFromSettings(settings pcommon.SetSettings, assetType pcommon.AssetType) (int8, bool) {
+	value, ok := settings.Settings[DECIMALS_SETTING_PREFIX+string(assetType)]
+	if !ok {
+		return 0, false
+	}
+	return int8(value), true
+}
+
+// fetchPrices returns the USD prices of the tokens, from the settings if supplied, otherwise from the exchange.
+func fetchPrices(settings pcommon.SetSettings, adapter exchange.Adapter) (tokenA, tokenB float64, err error) {
+	tokenA, okA := priceFromSettings(settings, PRICE_A_SETTING_KEY)
+	tokenB, okB := priceFromSettings(settings, PRICE_B_SETTING_KEY)
+	if !okA {
+		if tokenA, err = adapter.GetUSDPrice(settings.ID[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if !okB {
+		if tokenB, err = adapter.GetUSDPrice(settings.ID[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return tokenA, tokenB, nil
+}
+
+func (s *Set) HasPrices() bool {
+	return s.cache[TOKEN_A_PRICE_KEY] != nil && s.cache[TOKEN_B_PRICE_KEY] != nil
+}
+
+// UpdatePrices stores the USD prices of the tokens, the decimals of the data written afterwards are computed from them.
+func (s *Set) UpdatePrices(tokenA, tokenB float64) error {
+	if tokenA <= 0 || tokenB <= 0 {
+		return errors.New("price must be greater than 0")
+	}
+	return s.storePrices(tokenA, tokenB)
+}
+
+/*
+BootstrapPrices sets the prices of the set from the price of the token A in token B.
+The USD price of the token B comes from the settings, is 1$ for a stable coin, or is fetched from the exchange.
+*/
+func (s *Set) BootstrapPrices(quotePrice float64) error {
+	tokenB, ok := priceFromSettings(s.Settings, PRICE_B_SETTING_KEY)
+	if !ok && strings.Contains(strings.ToUpper(s.Settings.ID[1]), "USD") {
+		tokenB, ok = 1.00, true
+	}
+	if !ok {
+		adapter, err := exchange.FromSettings(s.Settings)
+		if err != nil {
+			return err
+		}
+		if tokenB, err = adapter.GetUSDPrice(s.Settings.ID[1]); err != nil {
+			return fmt.Errorf("%w: the USD price of %s must be set in the settings (%s): %s", ErrPricesUnknown, s.Settings.ID[1], PRICE_B_SETTING_KEY, err)
+		}
+	}
+	return s.UpdatePrices(quotePrice*tokenB, tokenB)
+}
+
+// LatestQuotePrice returns the last stored price of the token A in token B, read from the price assets of the set.
+func (s *Set) LatestQuotePrice() (float64, error) {
+	for _, assetType := range PRICE_ASSETS {
+		for _, asset := range s.AssetList() {
+			if asset.Type() != assetType || len(asset.ParsedAddress().Arguments) > 0 {
+				continue
+			}
+			data, _, err := asset.GetLatestData(pcommon.Env.MIN_TIME_FRAME)
+			if err != nil {
+				return 0, err
+			}
+			switch unit := data.(type) {
+			case *pcommon.UnitTime:
+				if unit.Close > 0 {
+					return unit.Close, nil
+				}
+			case pcommon.UnitTime:
+				if unit.Close > 0 {
+					return unit.Close, nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("no price found in %s", s.ID())
+}
+
+/*
+RefreshPrices recomputes the prices of the set, from the settings and the exchange,
+or from the last stored price if the exchange can't be reached.
+*/
+func (s *Set) RefreshPrices() error {
+	adapter, err := exchange.FromSettings(s.Settings)
+	if err != nil {
+		return err
+	}
+	tokenA, tokenB, err := fetchPrices(s.Settings, adapter)
+	if err == nil {
+		return s.UpdatePrices(tokenA, tokenB)
+	}
+	quotePrice, errQuote := s.LatestQuotePrice()
+	if errQuote != nil {
+		return fmt.Errorf("%s: %w", err, errQuote)
+	}
+	return s.BootstrapPrices(quotePrice)
+}
@@ -0,0 +1,169 @@
+package set2
+
+import (
+	"time"
+
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type AlignmentKind int8
+
+const (
+	// candles boundaries are the multiples of the timeframe since the anchor (unix epoch by default)
+	ALIGN_EPOCH AlignmentKind = iota
+	// candles restart every day at midnight UTC, the last candle of the day is shortened
+	ALIGN_DAY
+	// candles boundaries are the first day of the calendar months (months and quarters)
+	ALIGN_CALENDAR
+)
+
+// ALIGNMENT_ANCHOR_SETTING_KEY is the set setting overriding the anchor (unix time in seconds) of the epoch aligned timeframes.
+const ALIGNMENT_ANCHOR_SETTING_KEY = "alignment_anchor"
+
+// weeks start on monday, the unix epoch is a thursday
+var WEEK_ANCHOR = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+/*
+TimeframeAlignment describes where the candles of a timeframe start and end.
+Candles are stored at their end time, a candle contains the ticks in [start, end).
+*/
+type TimeframeAlignment struct {
+	Kind      AlignmentKind
+	Timeframe time.Duration
+	Months    int       // candle length in calendar months (ALIGN_CALENDAR)
+	Anchor    time.Time // first candle boundary (ALIGN_EPOCH)
+}
+
+/*
+NewTimeframeAlignment returns the alignment of a timeframe:
+  - quarters and months (multiples of 30 days, up to MAX_TIME_FRAME) follow the calendar
+  - weeks start on monday
+  - timeframes dividing a day or multiple of a day are anchored on the unix epoch (or the custom anchor if not zero)
+  - other timeframes below a day are anchored on each midnight
+*/
+func NewTimeframeAlignment(timeframe time.Duration, anchor time.Time) TimeframeAlignment {
+	alignment := TimeframeAlignment{Kind: ALIGN_EPOCH, Timeframe: timeframe, Anchor: time.Unix(0, 0).UTC()}
+	if !anchor.IsZero() {
+		alignment.Anchor = anchor.UTC()
+	}
+
+	switch {
+	case timeframe%pcommon.MONTH == 0:
+		alignment.Kind = ALIGN_CALENDAR
+		alignment.Months = int(timeframe / pcommon.MONTH)
+	case timeframe%pcommon.WEEK == 0:
+		alignment.Anchor = WEEK_ANCHOR
+	case timeframe < pcommon.DAY && pcommon.DAY%timeframe != 0:
+		alignment.Kind = ALIGN_DAY
+	}
+	return alignment
+}
+
+// floorDiv returns the largest boundary count n such that anchor + n * step <= t
+func floorDiv(d, step time.Duration) int64 {
+	n := int64(d / step)
+	if d%step != 0 && d < 0 {
+		n--
+	}
+	return n
+}
+
+func (a TimeframeAlignment) candleStart(t time.Time) time.Time {
+	t = t.UTC()
+	switch a.Kind {
+	case ALIGN_CALENDAR:
+		months := (t.Year()-1970)*12 + int(t.Month()) - 1
+		n := floorDiv(time.Duration(months), time.Duration(a.Months))
+		return time.Date(1970, time.Month(1+n*int64(a.Months)), 1, 0, 0, 0, 0, time.UTC)
+	case ALIGN_DAY:
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return midnight.Add(a.Timeframe * time.Duration(t.Sub(midnight)/a.Timeframe))
+	default:
+		return a.Anchor.Add(a.Timeframe * time.Duration(floorDiv(t.Sub(a.Anchor), a.Timeframe)))
+	}
+}
+
+func (a TimeframeAlignment) candleEnd(start time.Time) time.Time {
+	switch a.Kind {
+	case ALIGN_CALENDAR:
+		return start.AddDate(0, a.Months, 0)
+	case ALIGN_DAY:
+		end := start.Add(a.Timeframe)
+		nextMidnight := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC)
+		if end.After(nextMidnight) {
+			return nextMidnight
+		}
+		return end
+	default:
+		return start.Add(a.Timeframe)
+	}
+}
+
+// CandleEnd returns the end time of the candle containing t.
+func (a TimeframeAlignment) CandleEnd(t pcommon.TimeUnit) pcommon.TimeUnit {
+	return pcommon.NewTimeUnitFromTime(a.candleEnd(a.candleStart(t.ToTime())))
+}
+
+// CandleStart returns the start time of the candle ending at end.
+func (a TimeframeAlignment) CandleStart(end pcommon.TimeUnit) pcommon.TimeUnit {
+	return pcommon.NewTimeUnitFromTime(a.candleStart(end.Add(-pcommon.TIME_UNIT_DURATION).ToTime()))
+}
+
+// Next returns the end time of the candle following the one ending at end.
+func (a TimeframeAlignment) Next(end pcommon.TimeUnit) pcommon.TimeUnit {
+	return a.CandleEnd(end)
+}
+
+// Advance returns the end time of the n-th candle following the one ending at end.
+func (a TimeframeAlignment) Advance(end pcommon.TimeUnit, n int) pcommon.TimeUnit {
+	if a.Kind == ALIGN_EPOCH {
+		return a.CandleEnd(end).Add(a.Timeframe * time.Duration(n-1))
+	}
+	for i := 0; i < n; i++ {
+		end = a.Next(end)
+	}
+	return end
+}
+
+// FirstCandle returns the range of the first candle of a data history starting at time0, the start being time0 itself.
+func (a TimeframeAlignment) FirstCandle(time0 pcommon.TimeUnit) (pcommon.TimeUnit, pcommon.TimeUnit) {
+	return time0, a.CandleEnd(time0)
+}
+
+// TimeframeAlignment returns the alignment of the candles of the asset on the given timeframe.
+func (state *AssetState) TimeframeAlignment(timeframe time.Duration) TimeframeAlignment {
+	anchor := time.Time{}
+	if seconds, ok := state.SetRef.Settings.Settings[ALIGNMENT_ANCHOR_SETTING_KEY]; ok {
+		anchor = time.Unix(seconds, 0)
+	}
+	return NewTimeframeAlignment(timeframe, anchor)
+}
+
+// Divides returns true if every candle boundary of the target is a candle boundary of a, so the candles of a nest exactly into the target ones.
+func (a TimeframeAlignment) Divides(target TimeframeAlignment) bool {
+	if a.Timeframe >= target.Timeframe {
+		return false
+	}
+
+	switch a.Kind {
+	case ALIGN_CALENDAR:
+		return target.Kind == ALIGN_CALENDAR && target.Months%a.Months == 0
+	case ALIGN_DAY:
+		return false
+	}
+
+	//a boundary is anchor + k * step, it is a boundary of a if both the step and the offset from the anchor of a are multiples of a's timeframe
+	hasBoundaries := func(anchor time.Time, step time.Duration) bool {
+		return step%a.Timeframe == 0 && anchor.Sub(a.Anchor)%a.Timeframe == 0
+	}
+	midnight := time.Unix(0, 0).UTC()
+
+	switch target.Kind {
+	case ALIGN_CALENDAR:
+		return hasBoundaries(midnight, pcommon.DAY)
+	case ALIGN_DAY:
+		return hasBoundaries(midnight, pcommon.DAY) && target.Timeframe%a.Timeframe == 0
+	default:
+		return hasBoundaries(target.Anchor, target.Timeframe)
+	}
+}
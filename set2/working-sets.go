@@ -50,6 +50,7 @@ func (s *WorkingSets) Add(setting pcommon.SetSettings) (*Set, error) {
 	}
 
 	(*s)[id] = set
+	invalidateDependencyGraph()
 
 	return set, nil
 }
@@ -59,6 +60,7 @@ func (s *WorkingSets) Remove(id string) {
 	defer mu.Unlock()
 
 	delete(*s, id)
+	invalidateDependencyGraph()
 }
 
 func (s *WorkingSets) StopAll() {
@@ -68,3 +70,8 @@ func (s *WorkingSets) StopAll() {
 		set.Close()
 	}
 }
+
+// Dependents returns the assets of all the sets having the given address as direct dependency.
+func (s *WorkingSets) Dependents(address pcommon.AssetAddress) []*AssetState {
+	return s.DependencyGraph().Dependents(address)
+}
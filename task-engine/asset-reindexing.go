@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"errors"
+	setlib "pendulev2/set2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+// set on the runners indexing an asset not added to its set yet, which can't be rebuilt after an interruption
+const ARG_VALUE_PREPARED = "prepared"
+
+var ErrReindexingInterrupted = errors.New("the reindexing was cancelled or interrupted")
+
+func buildComputedIndexingRunner(asset *setlib.AssetState, timeframe time.Duration) *gorunner.Runner {
+	if setlib.IsBarAsset(asset.Type()) {
+		return buildBarIndexingRunner(asset)
+	}
+	return buildIndicatorIndexingRunner(asset, timeframe)
+}
+
+/*
+AddAssetReindexing indexes an asset computed from other assets, prepared but not added to its set yet,
+on the minimum timeframe then on the given timeframes, and calls done once it is up to date or on the first error.
+A runner stopping before the end is resumed until the asset stops progressing.
+The indexing can't be paused, and done is called with ErrReindexingInterrupted once it is cancelled, suspended or the process stops.
+*/
+func (e *engine) AddAssetReindexing(asset *setlib.AssetState, timeframes []time.Duration, done func(err error)) error {
+	if err := asset.FillDependencies(e.Sets); err != nil {
+		return err
+	}
+	if !asset.ParsedAddress().HasDependencies() {
+		return errors.New("only the assets computed from other assets can be reindexed")
+	}
+
+	list := []time.Duration{pcommon.Env.MIN_TIME_FRAME}
+	if !setlib.IsBarAsset(asset.Type()) {
+		for _, tf := range timeframes {
+			if tf > pcommon.Env.MIN_TIME_FRAME {
+				list = append(list, tf)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i] < list[j]
+	})
+
+	once := sync.Once{}
+	finish := done
+	done = func(err error) {
+		once.Do(func() {
+			finish(err)
+		})
+	}
+
+	var index func(i int)
+	index = func(i int) {
+		if i == len(list) {
+			done(nil)
+			return
+		}
+		timeframe := list[i]
+		before, err := asset.GetLastConsistencyTimeCached(timeframe)
+		if err != nil {
+			done(err)
+			return
+		}
+
+		r := buildComputedIndexingRunner(asset, timeframe)
+		r.Args[ARG_VALUE_PREPARED] = true
+		abort := func() {
+			done(ErrReindexingInterrupted)
+		}
+		e.add(r, abort, func(engine *gorunner.Engine, runner *gorunner.Runner) {
+			if err := runner.GetError(); err != nil {
+				done(err)
+				return
+			}
+			after, err := asset.GetLastConsistencyTimeCached(timeframe)
+			if err != nil {
+				done(err)
+				return
+			}
+			if after > before {
+				index(i)
+			} else {
+				index(i + 1)
+			}
+		})
+	}
+	index(0)
+	return nil
+}
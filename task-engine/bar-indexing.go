@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"math"
+	setlib "pendulev2/set2"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+/*
+addBarIndexingRunnerProcess builds, day by day, the bars of the asset from the minimum timeframe ticks of its price and volume dependencies.
+The bar being built at the end of a day is kept in the prev state, so the indexing resumes from it.
+*/
+func addBarIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetState) {
+	process := func() error {
+		timeframe := pcommon.Env.MIN_TIME_FRAME
+		price, volume := asset.DependenciesRef[0], asset.DependenciesRef[1]
+
+		//calculate the minimum time of the dependencies
+		minLastDependenciesTime := pcommon.TimeUnit(math.MaxInt64)
+		for _, dep := range asset.DependenciesRef {
+			maxTimeDep, err := dep.GetLastConsistencyTimeCached(timeframe)
+			if err != nil {
+				return err
+			}
+			if maxTimeDep < minLastDependenciesTime {
+				minLastDependenciesTime = maxTimeDep
+			}
+		}
+		if minLastDependenciesTime > pcommon.NewTimeUnitFromTime(time.Now()) {
+			return nil
+		}
+
+		if err := asset.AddIfUnfoundInReadList(timeframe); err != nil {
+			return err
+		}
+
+		t0, err := asset.GetLastConsistencyTimeCached(timeframe)
+		if err != nil {
+			return err
+		}
+		if t0 == 0 {
+			t0 = asset.DataHistoryTime0()
+		}
+		if t0 >= minLastDependenciesTime {
+			return nil
+		}
+
+		prevState, err := asset.GetLastPrevStateCached(timeframe)
+		if err != nil {
+			return err
+		}
+
+		builder, err := setlib.NewBarBuilder(asset.Type(), asset.ParsedAddress().Arguments, prevState.State())
+		if err != nil {
+			return err
+		}
+
+		//log every 5 seconds the indexing status
+		go func() {
+			for runner.Task.IsRunning() {
+				time.Sleep(5 * time.Second)
+				printTimeframeIndexingStatus(runner, asset)
+			}
+		}()
+
+		runner.SetSize().Initial(t0.Int())
+		runner.SetSize().Max(minLastDependenciesTime.Int())
+
+		for t0 < minLastDependenciesTime {
+			t1 := t0.Add(pcommon.DAY)
+			if t1 > minLastDependenciesTime {
+				t1 = minLastDependenciesTime
+			}
+
+			prices, err := price.GetInDataRange(t0, t1, timeframe, nil, nil, false)
+			if err != nil {
+				return err
+			}
+			volumes, err := volume.GetInDataRange(t0, t1, timeframe, nil, nil, false)
+			if err != nil {
+				return err
+			}
+
+			volumeByTime := make(map[pcommon.TimeUnit]pcommon.QuantityTime, volumes.Len())
+			for _, v := range volumes.Map() {
+				q := unpointerData(v).(pcommon.QuantityTime)
+				volumeByTime[q.Time] = q
+			}
+
+			batch := pcommon.UnitTimeArray{}
+			for _, p := range prices.Map() {
+				tick := unpointerData(p).(pcommon.UnitTime)
+				for _, bar := range builder.Push(tick, volumeByTime[tick.Time]) {
+					prevState.CheckUpdateMin(bar.Min(), bar.Time)
+					prevState.CheckUpdateMax(bar.Max(), bar.Time)
+					batch = append(batch, bar)
+				}
+			}
+
+			//the consistency moves forward even without any bar closed, the open bar being kept in the prev state
+			prevState.UpdateState(builder.State())
+			if err := asset.Store(batch.ToRaw(asset.Decimals()), timeframe, prevState.Copy(), t1); err != nil {
+				return err
+			}
+			runner.IncrementStatValue(STAT_VALUE_DATA_COUNT, int64(len(batch)))
+
+			t0 = t1
+			runner.SetSize().Current(t0.Int(), false)
+			if runner.MustInterrupt() {
+				break
+			}
+		}
+		runner.AddStep()
+		printTimeframeIndexingStatus(runner, asset)
+		return nil
+	}
+
+	runner.AddProcess(process)
+}
+
+func buildBarIndexingRunner(asset *setlib.AssetState) *gorunner.Runner {
+	timeframe := pcommon.Env.MIN_TIME_FRAME
+	runner := gorunner.NewRunner(buildTimeFrameIndexingKey(asset.Address(), timeframe))
+
+	addTimeframe(runner, timeframe)
+	addAssetAddresses(runner, []pcommon.AssetAddress{asset.Address()})
+
+	addBarIndexingRunnerProcess(runner, asset)
+
+	//same as the indicators: wait for the runners writing the bar or its dependencies
+	runner.AddRunningFilter(func(details gorunner.EngineDetails, runner *gorunner.Runner) bool {
+		for _, r := range details.RunningRunners {
+			if !haveSameAddresses(r, runner) {
+				continue
+			}
+			if !haveSameTimeframe(r, runner) {
+				continue
+			}
+			for _, addr := range getDepAddresses(getAddresses(runner)[0]) {
+				if isAddressInRunner(r, addr) {
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	return runner
+}
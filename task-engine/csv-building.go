@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"pendulev2/metrics"
 	setlib "pendulev2/set2"
 	"pendulev2/util"
 	"strings"
@@ -69,18 +70,18 @@ func printBuildCSVStatus(runner *gorunner.Runner) {
 
 	switch runner.CountSteps() {
 	case 0:
-		log.WithFields(log.Fields{
+		runnerLog(runner).WithFields(log.Fields{
 			"progress": fmt.Sprintf("%.2f%%", runner.Percent()),
 			"buildID":  csvStatus.BuildID,
 			"eta":      pcommon.Format.AccurateHumanize(runner.ETA()),
 		}).Info("Building CSV archive")
 	case 1:
-		log.WithFields(log.Fields{
+		runnerLog(runner).WithFields(log.Fields{
 			"size":    pcommon.Format.LargeBytesToShortString(runner.StatValue(STAT_VALUE_ARCHIVE_SIZE)),
 			"buildID": csvStatus.BuildID,
 		}).Info("Zipping CSV archive")
 	case 2:
-		log.WithFields(log.Fields{
+		runnerLog(runner).WithFields(log.Fields{
 			"size":    pcommon.Format.LargeBytesToShortString(runner.StatValue(STAT_VALUE_ARCHIVE_SIZE)),
 			"buildID": csvStatus.BuildID,
 			"done":    "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
@@ -156,6 +157,13 @@ func buildCSV(runner *gorunner.Runner) error {
 		if err := writeCSVLines(writer, lines, &froms, &cumulatedWrittenSize, runner); err != nil {
 			return err
 		}
+		//an interrupted export is rebuilt from scratch, its file is closed before its folder is removed
+		if runner.MustInterrupt() {
+			if err := closeCSVFile(writer, file); err != nil {
+				return err
+			}
+			return os.RemoveAll(parameters.BuildCSVArchiveFolderPath())
+		}
 
 		if cumulatedWrittenSize > MAX_SIZE_CSV_FILE_BYTES {
 			if err := closeCSVFile(writer, file); err != nil {
@@ -270,7 +278,7 @@ func createCSVLine(parameters *setlib.CSVOrderUnpacked, listData *map[pcommon.As
 
 		if list == nil || list.Len() == 0 {
 			if !areAllOrderDone(parameters, listData) {
-				assetLine := pcommon.NewTypeTime(order.Asset.DataType(), 0, 0).CSVLine(precision, columns)
+				assetLine := pcommon.NewTypeTime(order.Asset.ReadDataType(), 0, 0).CSVLine(precision, columns)
 				line = append(line, assetLine...)
 			}
 			continue
@@ -282,7 +290,7 @@ func createCSVLine(parameters *setlib.CSVOrderUnpacked, listData *map[pcommon.As
 			assetLine = first.CSVLine(precision, columns)
 			(*listData)[assetStateID] = (*listData)[assetStateID].RemoveFirstN(1)
 		} else {
-			assetLine = pcommon.NewTypeTime(order.Asset.DataType(), 0, 0).CSVLine(precision, columns)
+			assetLine = pcommon.NewTypeTime(order.Asset.ReadDataType(), 0, 0).CSVLine(precision, columns)
 		}
 		line = append(line, assetLine...)
 	}
@@ -301,6 +309,7 @@ func writeCSVLines(writer *csv.Writer, lines []string, froms *[]pcommon.TimeUnit
 	runner.SetSize().Current(getLeastFromTime(*froms).Int(), false)
 	runner.IncrementStatValue(STAT_VALUE_ARCHIVE_SIZE, int64(linesSize))
 	runner.IncrementStatValue(STAT_VALUE_LINE_COUNT, int64(len(lines)))
+	metrics.CSVBytesWritten.Add(float64(linesSize))
 	return nil
 }
 
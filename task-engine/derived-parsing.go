@@ -0,0 +1,355 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"pendulev2/exchange"
+	"pendulev2/metrics"
+	setlib "pendulev2/set2"
+	"pendulev2/util"
+	"strings"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+)
+
+// getArchiveZipPaths returns the archives needed to parse the given date of an asset
+func getArchiveZipPaths(asset *setlib.AssetState, date string) []string {
+	if derived, ok := setlib.DERIVED_ASSETS[asset.Type()]; ok {
+		return lo.Map(derived.Sources, func(source pcommon.AssetType, _ int) string {
+			return asset.SetRef.Settings.BuildArchiveFilePath(source, date, "zip")
+		})
+	}
+	return []string{asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "zip")}
+}
+
+// fetchArchive asks the exchange of the set for the archives of the given date of an asset, if the venue serves them directly.
+func fetchArchive(asset *setlib.AssetState, date string) error {
+	archiveType := setlib.RequiredArchiveType(asset.Type())
+	if archiveType == nil {
+		return exchange.ErrNoIngestion
+	}
+	adapter, err := exchange.FromSettings(asset.SetRef.Settings)
+	if err != nil {
+		return err
+	}
+	return adapter.FetchArchive(*archiveType, date, asset.SetRef.Settings)
+}
+
+// getDerivedSiblings returns the derived assets of the set sharing the archive of the given derived asset and waiting for the same date.
+func getDerivedSiblings(asset *setlib.AssetState, date string) []*setlib.AssetState {
+	archiveType := setlib.RequiredArchiveType(asset.Type())
+
+	siblings := []*setlib.AssetState{asset}
+	for _, sibling := range asset.SetRef.AssetList() {
+		if !setlib.IsDerivedAsset(sibling.Type()) || sibling.Address() == asset.Address() {
+			continue
+		}
+		siblingArchiveType := setlib.RequiredArchiveType(sibling.Type())
+		if archiveType == nil || siblingArchiveType == nil || *siblingArchiveType != *archiveType {
+			continue
+		}
+		siblingDate, err := sibling.ShouldSync()
+		if err != nil || siblingDate == nil || *siblingDate != date {
+			continue
+		}
+		siblings = append(siblings, sibling)
+	}
+	return siblings
+}
+
+// parseDay parses the given date of an asset, either from its own archive or from the archives of its sources if it is a derived asset.
+func parseDay(runner *gorunner.Runner, asset *setlib.AssetState, date string) (pcommon.DataList, *setlib.IngestionRecord, error) {
+	if setlib.IsDerivedAsset(asset.Type()) {
+		lists, records, err := parseDerivedDay(runner, []*setlib.AssetState{asset}, date)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lists[0], records[0], nil
+	}
+	return parseArchiveDay(runner, asset, date)
+}
+
+/*
+parseDerivedDay unzips once the source archives of the given derived assets for the given date,
+and computes the rows of every derived asset in a single pass over the aligned source lines.
+The runner steps are incremented the same way as parseArchiveDay.
+*/
+func parseDerivedDay(runner *gorunner.Runner, assets []*setlib.AssetState, date string) ([]pcommon.DataList, []*setlib.IngestionRecord, error) {
+	sources := []pcommon.AssetType{}
+	for _, asset := range assets {
+		sources = append(sources, setlib.DERIVED_ASSETS[asset.Type()].Sources...)
+	}
+	sources = lo.Uniq(sources)
+
+	tmpDir, err := os.MkdirTemp("", "derived-"+date+"-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	set := assets[0].SetRef
+	checksums := map[pcommon.AssetType]string{}
+	archivesSize := int64(0)
+	for _, source := range sources {
+		archiveFilePathZIP := set.Settings.BuildArchiveFilePath(source, date, "zip")
+		size, err := pcommon.File.GetFileSize(archiveFilePathZIP)
+		if err != nil {
+			return nil, nil, err
+		}
+		archivesSize += size
+		checksums[source], err = util.FileSha256(archiveFilePathZIP)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	runner.SetStatValue(STAT_VALUE_ARCHIVE_SIZE, archivesSize)
+
+	for _, source := range sources {
+		if err := pcommon.File.UnzipFile(set.Settings.BuildArchiveFilePath(source, date, "zip"), filepath.Join(tmpDir, string(source))); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	runner.AddStep()
+	sourceLines := map[pcommon.AssetType][]CSVLine{}
+	for _, source := range sources {
+		lines, err := parseFromCSVFile(filepath.Join(tmpDir, string(source), date+".csv"))
+		if err != nil {
+			return nil, nil, err
+		}
+		sourceLines[source] = lines
+		metrics.TicksParsed.WithLabelValues(set.ID(), string(source)).Add(float64(len(lines)))
+	}
+
+	runner.SetSize().Max(int64(len(sourceLines[sources[0]])))
+	runner.AddStep()
+
+	lists := make([]pcommon.DataList, len(assets))
+	records := make([]*setlib.IngestionRecord, len(assets))
+	for i, asset := range assets {
+		derived := setlib.DERIVED_ASSETS[asset.Type()]
+		lines := lo.Map(derived.Sources, func(source pcommon.AssetType, _ int) []CSVLine {
+			return sourceLines[source]
+		})
+		dataList, err := aggregateDerivedLines(lines, derived, asset)
+		if err != nil {
+			return nil, nil, err
+		}
+		lists[i] = dataList
+
+		records[i] = &setlib.IngestionRecord{
+			Date:      date,
+			LineCount: int64(len(lines[0])),
+			RowCount:  int64(dataList.Len()),
+			Checksum: strings.Join(lo.Map(derived.Sources, func(source pcommon.AssetType, _ int) string {
+				return checksums[source]
+			}), "-"),
+			ParsedAt: pcommon.NewTimeUnitFromTime(time.Now()),
+		}
+		if dataList.Len() > 0 {
+			records[i].MinTime = dataList.First().GetTime()
+			records[i].MaxTime = dataList.Last().GetTime()
+		}
+	}
+
+	return lists, records, nil
+}
+
+// joinSourcesOnTime aligns the lines of the sources on the timestamps present in every source, keeping the last value of each timestamp.
+func joinSourcesOnTime(sources [][]CSVLine) [][]CSVLine {
+	values := make([]map[pcommon.TimeUnit]float64, len(sources))
+	for i, lines := range sources {
+		values[i] = make(map[pcommon.TimeUnit]float64, len(lines))
+		for _, line := range lines {
+			values[i][line.Timestamp] = line.Value
+		}
+	}
+
+	joined := make([][]CSVLine, len(sources))
+	seen := map[pcommon.TimeUnit]bool{}
+	for _, line := range sources[0] {
+		if seen[line.Timestamp] {
+			continue
+		}
+		seen[line.Timestamp] = true
+
+		found := true
+		for _, v := range values[1:] {
+			if _, ok := v[line.Timestamp]; !ok {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		for i := range sources {
+			joined[i] = append(joined[i], CSVLine{Timestamp: line.Timestamp, Value: values[i][line.Timestamp]})
+		}
+	}
+	return joined
+}
+
+// aggregateDerivedLines is the equivalent of aggregateLinesToValuesToPrices for derived assets, sources lines must be aligned unless the derived asset joins them on time.
+func aggregateDerivedLines(sources [][]CSVLine, derived setlib.DerivedAsset, state *setlib.AssetState) (pcommon.DataList, error) {
+	if derived.JoinOnTime {
+		sources = joinSourcesOnTime(sources)
+	}
+
+	for _, lines := range sources[1:] {
+		if len(lines) != len(sources[0]) {
+			return nil, fmt.Errorf("source archives of %s are not aligned", state.Type())
+		}
+	}
+
+	args := state.Settings().Address.Arguments
+	div := pcommon.TimeUnit(0).Add(pcommon.Env.MIN_TIME_FRAME)
+
+	bucket := pcommon.NewTypeTimeArray(state.DataType())
+	bucketLines := [][]float64{}
+	prevTime := pcommon.TimeUnit(0)
+
+	flush := func() {
+		if len(bucketLines) == 0 {
+			return
+		}
+		tmpList := pcommon.NewTypeTimeArray(state.DataType())
+		if derived.Bucket != nil {
+			if data, ok := derived.Bucket(bucketLines, args, prevTime); ok {
+				tmpList = tmpList.Append(data)
+			}
+		} else {
+			for _, values := range bucketLines {
+				if value, ok := derived.Line(values, args); ok {
+					tmpList = tmpList.Append(pcommon.NewTypeTime(state.DataType(), value, prevTime))
+				}
+			}
+		}
+		if tmpList.Len() > 0 {
+			bucket = bucket.Append(tmpList.Aggregate(pcommon.Env.MIN_TIME_FRAME, prevTime))
+		}
+		bucketLines = [][]float64{}
+	}
+
+	for i, line := range sources[0] {
+		values := make([]float64, len(sources))
+		for j, lines := range sources {
+			if lines[i].Timestamp != line.Timestamp {
+				return nil, fmt.Errorf("source archives of %s are not aligned", state.Type())
+			}
+			values[j] = lines[i].Value
+		}
+
+		currentTime := line.Timestamp
+		if div > 0 {
+			currentTime /= div
+			currentTime *= div
+		}
+		if prevTime != 0 && prevTime != currentTime {
+			flush()
+		}
+		bucketLines = append(bucketLines, values)
+		prevTime = currentTime
+	}
+	flush()
+
+	return bucket, nil
+}
+
+func addDerivedParsingRunnerProcess(runner *gorunner.Runner, assets []*setlib.AssetState) {
+	process := func() error {
+		date := getDate(runner)
+		dateTime, err := pcommon.Format.StrDateToDate(date)
+		if err != nil {
+			return err
+		}
+
+		//a sibling parsed meanwhile is not parsed again
+		toParse := lo.Filter(assets, func(asset *setlib.AssetState, _ int) bool {
+			dateToSync, err := asset.ShouldSync()
+			return err == nil && dateToSync != nil && *dateToSync == date
+		})
+		if len(toParse) == 0 {
+			return nil
+		}
+
+		go func() {
+			time.Sleep(2 * time.Second)
+			for runner.IsRunning() {
+				printStateParsingStatus(runner, toParse[0])
+				time.Sleep(5 * time.Second)
+			}
+		}()
+
+		lists, records, err := parseDerivedDay(runner, toParse, date)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureSetPrices(toParse, lists); err != nil {
+			return err
+		}
+
+		runner.AddStep()
+		for i, asset := range toParse {
+			//each asset is stored with its own consistency, so the parsing can stop between two of them
+			if runner.MustInterrupt() {
+				return nil
+			}
+			prevState, err := asset.GetLastPrevStateCached(pcommon.Env.MIN_TIME_FRAME)
+			if err != nil {
+				return err
+			}
+			for _, tick := range lists[i].Map() {
+				prevState.CheckUpdateMax(tick.Max(), tick.GetTime())
+				prevState.CheckUpdateMin(tick.Min(), tick.GetTime())
+			}
+			runner.IncrementStatValue(STAT_VALUE_DATA_COUNT, int64(lists[i].Len()))
+			if err := asset.Store(lists[i].ToRaw(asset.Decimals()), pcommon.Env.MIN_TIME_FRAME, prevState.Copy(), pcommon.NewTimeUnitFromTime(dateTime).Add(time.Hour*24)); err != nil {
+				return err
+			}
+			if err := asset.StoreIngestionRecord(*records[i]); err != nil {
+				return err
+			}
+		}
+
+		runner.AddStep()
+		printStateParsingStatus(runner, toParse[0])
+		return nil
+	}
+	runner.AddProcess(process)
+}
+
+// buildDerivedParsingRunner parses the given date of several derived assets sharing the same source archives in one pass.
+func buildDerivedParsingRunner(assets []*setlib.AssetState, date string) *gorunner.Runner {
+	runner := gorunner.NewRunner(STATE_PARSING_KEY + "-" + string(assets[0].Address()) + "-" + date)
+
+	addTimeframe(runner, pcommon.Env.MIN_TIME_FRAME)
+	addDate(runner, date)
+	addAssetAddresses(runner, lo.Map(assets, func(asset *setlib.AssetState, _ int) pcommon.AssetAddress {
+		return asset.Address()
+	}))
+
+	runner.AddRunningFilter(func(details gorunner.EngineDetails, runner *gorunner.Runner) bool {
+		for _, r := range details.RunningRunners {
+			if !haveSameAddresses(r, runner) {
+				continue
+			}
+
+			if !haveSameTimeframe(r, runner) {
+				continue
+			}
+
+			return false
+		}
+
+		return true
+	})
+
+	addDerivedParsingRunnerProcess(runner, assets)
+	return runner
+}
@@ -0,0 +1,314 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"pendulev2/util"
+
+	"github.com/fantasim/gorunner"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+The disk watchdog checks the free space of the directories the engine writes to.
+Below the low threshold, the parsing of archives and the exports are held in the queue and the value logs of the sets are garbage collected.
+Below the critical threshold, no runner is dispatched and the running ones stop at their next safe point,
+they are queued again once the free space is back above the critical threshold.
+A level is only left once the free space is above its threshold by DISK_RECOVERY_MARGIN, so a disk around a threshold doesn't flap.
+*/
+
+// DISK_LOW_THRESHOLD_ENV sets the percentage of free space below which the disk is low.
+const DISK_LOW_THRESHOLD_ENV = "DISK_LOW_THRESHOLD"
+
+// DISK_CRITICAL_THRESHOLD_ENV sets the percentage of free space below which the disk is critical.
+const DISK_CRITICAL_THRESHOLD_ENV = "DISK_CRITICAL_THRESHOLD"
+
+const (
+	DEFAULT_DISK_LOW_THRESHOLD      = 10
+	DEFAULT_DISK_CRITICAL_THRESHOLD = 3
+	DISK_CHECK_INTERVAL             = 30 * time.Second
+	//in percentage points of free space
+	DISK_RECOVERY_MARGIN = 1
+	//the value logs are garbage collected at most once per interval while the disk is low
+	DISK_GC_INTERVAL = 10 * time.Minute
+)
+
+type DiskLevel string
+
+const (
+	DISK_LEVEL_OK       DiskLevel = "ok"
+	DISK_LEVEL_LOW      DiskLevel = "low"
+	DISK_LEVEL_CRITICAL DiskLevel = "critical"
+)
+
+func (l DiskLevel) rank() int {
+	switch l {
+	case DISK_LEVEL_LOW:
+		return 1
+	case DISK_LEVEL_CRITICAL:
+		return 2
+	}
+	return 0
+}
+
+type DiskStatus struct {
+	util.DiskSpace
+	FreePercent float64   `json:"free_percent"`
+	Level       DiskLevel `json:"level"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type DiskWatchdogState struct {
+	Level             DiskLevel    `json:"level"` //the worst level of the disks
+	Since             int64        `json:"since"` //in milliseconds
+	LowThreshold      float64      `json:"low_threshold"`
+	CriticalThreshold float64      `json:"critical_threshold"`
+	Disks             []DiskStatus `json:"disks"`
+	HeldClasses       []string     `json:"held_classes"` //the priority classes not dispatched
+	Suspended         int          `json:"suspended"`    //running jobs stopped at the critical level, waiting to be queued again
+	LastGC            int64        `json:"last_gc"`      //in milliseconds, 0 if never
+}
+
+type diskWatchdog struct {
+	mu        sync.Mutex
+	dirs      []string
+	low       float64
+	critical  float64
+	state     DiskWatchdogState
+	gcRunning bool
+}
+
+func newDiskWatchdog(dirs []string) (*diskWatchdog, error) {
+	w := &diskWatchdog{
+		dirs:     dirs,
+		low:      DEFAULT_DISK_LOW_THRESHOLD,
+		critical: DEFAULT_DISK_CRITICAL_THRESHOLD,
+	}
+	for env, threshold := range map[string]*float64{DISK_LOW_THRESHOLD_ENV: &w.low, DISK_CRITICAL_THRESHOLD_ENV: &w.critical} {
+		if v := os.Getenv(env); v != "" {
+			pct, err := strconv.ParseFloat(v, 64)
+			if err != nil || pct < 0 || pct >= 100 {
+				return nil, fmt.Errorf("%s: invalid value %q", env, v)
+			}
+			*threshold = pct
+		}
+	}
+	if w.critical > w.low {
+		return nil, fmt.Errorf("%s must be lower than %s", DISK_CRITICAL_THRESHOLD_ENV, DISK_LOW_THRESHOLD_ENV)
+	}
+	w.state = DiskWatchdogState{
+		Level:             DISK_LEVEL_OK,
+		Since:             time.Now().UnixMilli(),
+		LowThreshold:      w.low,
+		CriticalThreshold: w.critical,
+		Disks:             []DiskStatus{},
+		HeldClasses:       []string{},
+	}
+	return w, nil
+}
+
+// admits returns true if a runner can be dispatched at the current level, the caller holds the lock of the queue.
+func (w *diskWatchdog) admits(r *gorunner.Runner) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch w.state.Level {
+	case DISK_LEVEL_CRITICAL:
+		return false
+	case DISK_LEVEL_LOW:
+		class := priorityClass(r)
+		return class != PRIORITY_CLASS_PARSING && class != PRIORITY_CLASS_EXPORT
+	}
+	return true
+}
+
+// measure returns the status of each directory, the thresholds of the levels at or below the previous one being raised by the recovery margin.
+func (w *diskWatchdog) measure(prev DiskLevel) []DiskStatus {
+	low, critical := w.low, w.critical
+	if prev.rank() >= DISK_LEVEL_LOW.rank() {
+		low += DISK_RECOVERY_MARGIN
+	}
+	if prev.rank() >= DISK_LEVEL_CRITICAL.rank() {
+		critical += DISK_RECOVERY_MARGIN
+	}
+	disks := []DiskStatus{}
+	for _, dir := range w.dirs {
+		space, err := util.GetDiskSpace(dir)
+		status := DiskStatus{DiskSpace: space, Level: DISK_LEVEL_OK}
+		if err != nil {
+			//an unreachable directory can't be written to either
+			status.Error = err.Error()
+			status.Level = DISK_LEVEL_CRITICAL
+		} else if space.Total > 0 {
+			status.FreePercent = float64(space.Free) / float64(space.Total) * 100
+			if status.FreePercent < critical {
+				status.Level = DISK_LEVEL_CRITICAL
+			} else if status.FreePercent < low {
+				status.Level = DISK_LEVEL_LOW
+			}
+		}
+		disks = append(disks, status)
+	}
+	return disks
+}
+
+// checkDisks measures the free space and applies the level it gives.
+func (e *engine) checkDisks() {
+	w := e.watchdog
+	w.mu.Lock()
+	current := w.state.Level
+	w.mu.Unlock()
+	disks := w.measure(current)
+	level := DISK_LEVEL_OK
+	for _, disk := range disks {
+		if disk.Level.rank() > level.rank() {
+			level = disk.Level
+		}
+	}
+
+	w.mu.Lock()
+	prev := w.state.Level
+	w.state.Disks = disks
+	if level != prev {
+		w.state.Level = level
+		w.state.Since = time.Now().UnixMilli()
+		switch level {
+		case DISK_LEVEL_CRITICAL:
+			w.state.HeldClasses = []string{PRIORITY_CLASS_EXPORT, PRIORITY_CLASS_ROLLBACK, PRIORITY_CLASS_INDEXING, PRIORITY_CLASS_PARSING}
+		case DISK_LEVEL_LOW:
+			w.state.HeldClasses = []string{PRIORITY_CLASS_EXPORT, PRIORITY_CLASS_PARSING}
+		default:
+			w.state.HeldClasses = []string{}
+		}
+	}
+	gc := level != DISK_LEVEL_OK && !w.gcRunning && time.Since(time.UnixMilli(w.state.LastGC)) > DISK_GC_INTERVAL
+	if gc {
+		w.gcRunning = true
+	}
+	w.mu.Unlock()
+
+	if level != prev {
+		logger := log.WithFields(log.Fields{"level": level, "previous": prev})
+		for _, disk := range disks {
+			logger = logger.WithField(disk.Path, fmt.Sprintf("%.1f%% free", disk.FreePercent))
+		}
+		if level == DISK_LEVEL_OK {
+			logger.Info("Disk space back to normal, writers resumed")
+		} else {
+			logger.Warn("Disk space low, writers held")
+		}
+	}
+	if gc {
+		go e.collectValueLogs()
+	}
+
+	if level == DISK_LEVEL_CRITICAL && prev != DISK_LEVEL_CRITICAL {
+		e.suspendWriters()
+	}
+	if level != DISK_LEVEL_CRITICAL && prev == DISK_LEVEL_CRITICAL {
+		e.resumeWriters()
+	}
+	if level != prev {
+		e.dispatch()
+	}
+}
+
+// collectValueLogs reclaims the space of the deleted and overwritten values of the sets.
+func (e *engine) collectValueLogs() {
+	for _, set := range e.Sets.Range() {
+		set.RunValueLogGC()
+	}
+	e.watchdog.mu.Lock()
+	e.watchdog.gcRunning = false
+	e.watchdog.state.LastGC = time.Now().UnixMilli()
+	e.watchdog.mu.Unlock()
+	log.Info("Value logs garbage collected")
+}
+
+// suspendWriters takes the jobs in the runner engine back, the running ones stopping at their next safe point.
+func (e *engine) suspendWriters() {
+	e.dispatchMu.Lock()
+	e.queue.mu.Lock()
+	suspended := 0
+	aborted := []*job{}
+	for id, j := range e.queue.jobs {
+		if !j.dispatched {
+			continue
+		}
+		//a runner can't run twice, the ones that started are rebuilt once the disk is back
+		j.suspended = j.runner.HasStarted()
+		e.withdraw(j)
+		if j.suspended && j.abort != nil {
+			delete(e.queue.jobs, id)
+			aborted = append(aborted, j)
+		} else if j.suspended {
+			suspended++
+		}
+	}
+	if len(aborted) > 0 {
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+	e.dispatchMu.Unlock()
+	for _, j := range aborted {
+		e.cancelled(j)
+	}
+
+	e.watchdog.mu.Lock()
+	e.watchdog.state.Suspended = suspended
+	e.watchdog.mu.Unlock()
+}
+
+// resumeWriters queues again, in their original order, the jobs stopped at the critical level, once their runners stopped.
+func (e *engine) resumeWriters() {
+	e.queue.mu.Lock()
+	descriptors := []JobDescriptor{}
+	runners := []*gorunner.Runner{}
+	for id, j := range e.queue.jobs {
+		if !j.suspended {
+			continue
+		}
+		j.suspended = false
+		//a job paused meanwhile is rebuilt when resumed
+		if !j.descriptor.Paused {
+			descriptors = append(descriptors, j.descriptor)
+			runners = append(runners, j.runner)
+			delete(e.queue.jobs, id)
+		}
+	}
+	if len(descriptors) > 0 {
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+
+	e.watchdog.mu.Lock()
+	e.watchdog.state.Suspended = 0
+	e.watchdog.mu.Unlock()
+
+	//a rebuilt runner must not run alongside the one it replaces
+	for _, r := range runners {
+		waitStopped(r)
+	}
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Sequence < descriptors[j].Sequence
+	})
+	for _, d := range descriptors {
+		err := e.replay(d)
+		if err != nil && err != util.ErrAlreadySync {
+			log.WithFields(log.Fields{
+				util.LOG_FIELD_RUNNER: d.ID,
+				"error":               err.Error(),
+			}).Warn("Job not resumed")
+		}
+	}
+}
+
+func (e *engine) DiskWatchdogState() DiskWatchdogState {
+	e.watchdog.mu.Lock()
+	defer e.watchdog.mu.Unlock()
+	return e.watchdog.state
+}
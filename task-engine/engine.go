@@ -1,22 +1,41 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"os"
+	"pendulev2/exchange"
+	"pendulev2/metrics"
 	setlib "pendulev2/set2"
+	"sort"
+	"sync"
 	"time"
 
 	util "pendulev2/util"
 
 	"github.com/fantasim/gorunner"
 	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
 )
 
 var Engine *engine = nil
 
+// how long the tasks of a dependent wait after a consistency advance of its dependencies, to coalesce the advances
+const CONSISTENCY_TRIGGER_DELAY = 2 * time.Second
+
 type engine struct {
 	*gorunner.Engine
-	Sets *setlib.WorkingSets
+	Sets       *setlib.WorkingSets
+	queue      *jobQueue
+	history    *jobHistory
+	retries    *retryPolicy
+	governor   *resourceGovernor
+	watchdog   *diskWatchdog
+	dispatchMu sync.Mutex
+
+	triggersMu sync.Mutex
+	triggers   map[pcommon.AssetAddress]bool //dependents whose tasks are about to run after a consistency advance
 }
 
 func (e *engine) Init(activeSets *setlib.WorkingSets) {
@@ -25,21 +44,104 @@ func (e *engine) Init(activeSets *setlib.WorkingSets) {
 			SetName("Parser").
 			SetMaxSimultaneousRunner(pcommon.Env.MAX_SIMULTANEOUS_PARSING)
 		Engine = &engine{
-			Engine: gorunner.NewEngine(options),
-			Sets:   activeSets,
+			Engine:   gorunner.NewEngine(options),
+			Sets:     activeSets,
+			queue:    newJobQueue(jobsFilePath()),
+			triggers: make(map[pcommon.AssetAddress]bool),
+		}
+		if err := initScheduler(); err != nil {
+			log.Fatal(err)
+		}
+		if err := initLiveness(); err != nil {
+			log.Fatal(err)
+		}
+		var err error
+		if Engine.history, err = newJobHistory(jobHistoryFilePath()); err != nil {
+			log.Fatal(err)
+		}
+		if err := Engine.history.load(); err != nil {
+			log.WithField("error", err.Error()).Error("Error loading the job history")
+		}
+		if Engine.retries, err = newRetryPolicy(jobFailuresFilePath()); err != nil {
+			log.Fatal(err)
 		}
+		if err := Engine.retries.load(); err != nil {
+			log.WithField("error", err.Error()).Error("Error loading the job failures")
+		}
+		if Engine.governor, err = newResourceGovernor(); err != nil {
+			log.Fatal(err)
+		}
+		if Engine.watchdog, err = newDiskWatchdog(util.DataDirs()); err != nil {
+			log.Fatal(err)
+		}
+		setlib.OnConsistencyAdvance(Engine.onConsistencyAdvance)
+		metrics.OnScrape(Engine.updateQueueMetrics)
+		//the runners held back by the scheduler are dispatched as soon as the engine has room for them
+		util.ScheduleTaskEvery(context.Background(), time.Second, Engine.dispatch)
+		Engine.checkDisks()
+		util.ScheduleTaskEvery(context.Background(), DISK_CHECK_INTERVAL, Engine.checkDisks)
 	}
 }
 
-func (e *engine) GetHTMLStatuses() []pcommon.StatusHTML {
-	list := []pcommon.StatusHTML{}
-	for _, r := range e.RunningRunners() {
-		html := HTMLify(r)
-		if html != nil {
-			list = append(list, *html)
+/*
+Add queues a runner unless a runner with the same ID is already queued or running, the callback being called once it is done or failed for good.
+The runner is persisted until then, so it is restored by RestoreJobs if the process stops before, and recorded in the history after.
+*/
+func (e *engine) Add(r *gorunner.Runner, callback ...func(engine *gorunner.Engine, runner *gorunner.Runner)) {
+	e.add(r, nil, callback...)
+}
+
+// add queues a runner like Add, abort being called instead of the callbacks if the job is cancelled or interrupted.
+func (e *engine) add(r *gorunner.Runner, abort func(), callback ...func(engine *gorunner.Engine, runner *gorunner.Runner)) {
+	if !e.queue.push(r, e.estimateMemory(r), abort) {
+		return
+	}
+	r.AddProcessCallback(func(engine *gorunner.Engine, runner *gorunner.Runner) {
+		e.queue.remove(runner)
+		e.dispatch()
+		outcome := JOB_OUTCOME_SUCCEEDED
+		if runner.GetError() != nil {
+			outcome = JOB_OUTCOME_FAILED
 		}
+		e.recordFinished(runner, outcome)
+		if isRetried(runner) {
+			e.retries.update(runner)
+		}
+		for _, cb := range callback {
+			cb(engine, runner)
+		}
+	})
+	e.dispatch()
+}
+
+/*
+onConsistencyAdvance runs the tasks of the dependents of an asset shortly after its minimum timeframe consistency moves forward,
+the advances happening meanwhile being coalesced into a single run per dependent.
+*/
+func (e *engine) onConsistencyAdvance(asset *setlib.AssetState, timeframe time.Duration, consistencyTime pcommon.TimeUnit) {
+	if timeframe != pcommon.Env.MIN_TIME_FRAME {
+		return
+	}
+	for _, dependent := range e.Sets.Dependents(asset.Address()) {
+		e.triggerAssetTasks(dependent)
+	}
+}
+
+func (e *engine) triggerAssetTasks(asset *setlib.AssetState) {
+	address := asset.Address()
+	e.triggersMu.Lock()
+	defer e.triggersMu.Unlock()
+	if e.triggers[address] {
+		return
 	}
-	return list
+	e.triggers[address] = true
+	time.AfterFunc(CONSISTENCY_TRIGGER_DELAY, func() {
+		//cleared before running, so an advance during the run triggers another one
+		e.triggersMu.Lock()
+		delete(e.triggers, address)
+		e.triggersMu.Unlock()
+		e.RunAssetTasks(asset)
+	})
 }
 
 func (e *engine) AddTimeframeIndexing(asset *setlib.AssetState, timeframe time.Duration) error {
@@ -53,6 +155,10 @@ func (e *engine) AddTimeframeIndexing(asset *setlib.AssetState, timeframe time.D
 	if timeframe <= pcommon.Env.MIN_TIME_FRAME {
 		return util.ErrTimeframeTooSmall
 	}
+	//bars are not bounded by time, they only exist on the minimum timeframe
+	if setlib.IsBarAsset(asset.Type()) {
+		return nil
+	}
 
 	if asset.ParsedAddress().HasDependencies() {
 		r := buildIndicatorIndexingRunner(asset, timeframe)
@@ -65,15 +171,43 @@ func (e *engine) AddTimeframeIndexing(asset *setlib.AssetState, timeframe time.D
 	return nil
 }
 
-func (e *engine) AddCSVBuilding(from int64, to int64, timeframe int64, packed [][]string) error {
-	p := setlib.CSVOrderPacked{
+// AddTimeframesIndexing indexes several timeframes of an asset parsed from archives in a single scan of its minimum timeframe ticks.
+func (e *engine) AddTimeframesIndexing(asset *setlib.AssetState, timeframes []time.Duration) error {
+	if asset.ParsedAddress().HasDependencies() {
+		return errors.New("asset is not parsed from archives")
+	}
+	for _, timeframe := range timeframes {
+		if _, err := pcommon.Format.TimeFrameToLabel(timeframe); err != nil {
+			return err
+		}
+		if timeframe <= pcommon.Env.MIN_TIME_FRAME {
+			return util.ErrTimeframeTooSmall
+		}
+	}
+
+	sorted := append([]time.Duration{}, timeframes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	r := buildTimeframesIndexingRunner(asset, sorted)
+	e.Add(r)
+	return nil
+}
+
+// AddCSVBuilding queues a CSV export, priority overrides the priority of the exports if not nil.
+func (e *engine) AddCSVBuilding(from int64, to int64, timeframe int64, packed [][]string, priority *Priority) error {
+	return e.addCSVBuilding(setlib.CSVOrderPacked{
 		Header: setlib.CSVOrderHeader{
 			From:      pcommon.NewTimeUnit(from),
 			To:        pcommon.NewTimeUnit(to),
 			Timeframe: time.Duration(timeframe) * pcommon.TIME_UNIT_DURATION,
 		},
 		Orders: packed,
-	}
+	}, priority)
+}
+
+func (e *engine) addCSVBuilding(p setlib.CSVOrderPacked, priority *Priority) error {
 	unpacked, err := p.Unpack(*e.Sets)
 	if err != nil {
 		return err
@@ -89,36 +223,60 @@ func (e *engine) AddCSVBuilding(from int64, to int64, timeframe int64, packed []
 	}
 
 	r := buildCSVBuildingRunner(unpacked)
+	setPriority(r, priority)
 	e.Add(r)
 	return nil
 }
 
-func (e *engine) RollBackState(state *setlib.AssetState, date string, timeframe time.Duration) error {
-	for _, set := range e.Sets.Range() {
-		for _, asset := range set.Assets {
-			if state.Address() != asset.Address() {
-				if asset.HasDependency(state.Address()) {
-					e.RollBackState(asset, date, timeframe)
-				}
-			}
+// RollBackTarget is an asset and the timeframes of it rolled back along with another asset.
+type RollBackTarget struct {
+	Asset      *setlib.AssetState
+	Timeframes []time.Duration
+}
+
+/*
+RollBackImpact lists the assets and timeframes RollBackState rolls back: the asset and all the assets computed from it, across sets.
+Rolling back the minimum timeframe rolls back all the active timeframes, since they are aggregated from it.
+*/
+func (e *engine) RollBackImpact(state *setlib.AssetState, timeframe time.Duration) []RollBackTarget {
+	targets := []RollBackTarget{}
+	for _, asset := range e.Sets.DependencyGraph().Impact(state.Address()) {
+		timeframes := []time.Duration{timeframe}
+		if timeframe <= pcommon.Env.MIN_TIME_FRAME {
+			timeframes = asset.GetActiveTimeFrameList()
+			sort.Slice(timeframes, func(i, j int) bool {
+				return timeframes[i] < timeframes[j]
+			})
 		}
+		targets = append(targets, RollBackTarget{Asset: asset, Timeframes: timeframes})
 	}
+	return targets
+}
 
-	//if timeframe less or equal to the minimum timeframe, we need to rollback all timeframes
-	if timeframe <= pcommon.Env.MIN_TIME_FRAME {
-		timeframes := state.GetActiveTimeFrameList()
-		for _, tf := range timeframes {
-			r := buildStateRollbackRunner(state, date, tf)
+// RollBackState rolls back the asset and the assets computed from it, priority overrides the priority of the rollbacks if not nil.
+func (e *engine) RollBackState(state *setlib.AssetState, date string, timeframe time.Duration, priority *Priority) error {
+	targets := e.RollBackImpact(state, timeframe)
+	//the dependents are rolled back first
+	for i := len(targets) - 1; i >= 0; i-- {
+		for _, tf := range targets[i].Timeframes {
+			r := buildStateRollbackRunner(targets[i].Asset, date, tf)
+			setPriority(r, priority)
 			e.Add(r)
 		}
-	} else {
-		r := buildStateRollbackRunner(state, date, timeframe)
-		e.Add(r)
 	}
-
 	return nil
 }
 
+// IsAssetBusy returns true if a running task of the queue reads or writes the asset of the given address, the others being cancelled by CancelAssetJobs.
+func (e *engine) IsAssetBusy(address pcommon.AssetAddress) bool {
+	for _, j := range e.queue.list() {
+		if j.runner.IsRunning() && lo.Contains(j.descriptor.Addresses, address) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *engine) AddStateParsing(asset *setlib.AssetState) error {
 	if err := asset.FillDependencies(e.Sets); err != nil {
 		return err
@@ -133,30 +291,100 @@ func (e *engine) AddStateParsing(asset *setlib.AssetState) error {
 	}
 
 	if asset.ParsedAddress().HasDependencies() {
+		//the dependencies, possibly from other sets, have to catch up first
+		ahead, err := asset.DependenciesAhead(pcommon.Env.MIN_TIME_FRAME)
+		if err != nil {
+			return err
+		}
+		if !ahead {
+			return util.ErrAlreadySync
+		}
+
 		r := buildIndicatorIndexingRunner(asset, pcommon.Env.MIN_TIME_FRAME)
-		r.AddProcessCallback(func(engine *gorunner.Engine, runner *gorunner.Runner) {
+		if setlib.IsBarAsset(asset.Type()) {
+			r = buildBarIndexingRunner(asset)
+		}
+		e.Add(r, func(engine *gorunner.Engine, runner *gorunner.Runner) {
 			if runner.CountSteps() >= 1 && runner.GetError() == nil {
 				e.RunAssetTasks(asset)
 			}
 		})
-		e.Add(r)
 		return nil
 	}
 
-	info, err := os.Stat(asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), *date, "zip"))
-	if err != nil {
+	//the failures of a derived parsing count against all the siblings
+	if err := e.retries.check(asset.Address(), *date); err != nil {
 		return err
 	}
-	if info.ModTime().Unix() > time.Now().Add(-time.Minute).Unix() {
-		return util.ErrFileIsTooRecent
+
+	for _, path := range getArchiveZipPaths(asset, *date) {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			//the venues without archiver write the archives of the assets on demand, complete once returned
+			fetchErr := fetchArchive(asset, *date)
+			if fetchErr == nil {
+				continue
+			}
+			if !errors.Is(fetchErr, exchange.ErrNoIngestion) {
+				return fetchErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Unix() > time.Now().Add(-time.Minute).Unix() {
+			return util.ErrFileIsTooRecent
+		}
+	}
+
+	if setlib.IsDerivedAsset(asset.Type()) {
+		siblings := getDerivedSiblings(asset, *date)
+		r := buildDerivedParsingRunner(siblings, *date)
+		e.Add(r, func(engine *gorunner.Engine, runner *gorunner.Runner) {
+			if runner.CountSteps() >= 4 && runner.GetError() == nil {
+				for _, sibling := range siblings {
+					e.RunAssetTasks(sibling)
+				}
+			}
+		})
+		return nil
 	}
 
 	r := buildStateParsingRunner(asset, *date)
-	r.AddProcessCallback(func(engine *gorunner.Engine, runner *gorunner.Runner) {
+	e.Add(r, func(engine *gorunner.Engine, runner *gorunner.Runner) {
 		if runner.CountSteps() >= 4 && runner.GetError() == nil {
 			e.RunAssetTasks(asset)
 		}
 	})
+	return nil
+}
+
+// AddDayReparsing queues the reparsing of a day, priority overrides the priority of the parsing if not nil.
+func (e *engine) AddDayReparsing(asset *setlib.AssetState, date string, priority *Priority) error {
+	if asset.ParsedAddress().HasDependencies() {
+		return errors.New("asset is not parsed from archives")
+	}
+
+	dateTime, err := pcommon.Format.StrDateToDate(date)
+	if err != nil {
+		return err
+	}
+	consistencyTime, err := asset.GetLastConsistencyTimeCached(pcommon.Env.MIN_TIME_FRAME)
+	if err != nil {
+		return err
+	}
+	if pcommon.NewTimeUnitFromTime(dateTime).Add(time.Hour*24) > consistencyTime {
+		return errors.New("date has not been parsed yet")
+	}
+
+	for _, path := range getArchiveZipPaths(asset, date) {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	r := buildDayReparsingRunner(asset, date)
+	setPriority(r, priority)
 	e.Add(r)
 	return nil
 }
@@ -165,8 +393,47 @@ func (e *engine) RunAssetTasks(asset *setlib.AssetState) error {
 	if err := asset.FillDependencies(e.Sets); err != nil {
 		return err
 	}
+
+	//the data computed by a previous version of a script is dropped, with the assets computed from it
+	if changed, err := scriptChanged(asset); err != nil {
+		return err
+	} else if changed {
+		util.AssetLog(asset.Address()).Warn("script changed, the asset is recomputed")
+		return e.RollBackState(asset, asset.Settings().MinDataDate, pcommon.Env.MIN_TIME_FRAME, nil)
+	}
+
 	Engine.AddStateParsing(asset)
-	for _, tf := range asset.SetRef.GetAllAssetsTimeframes() {
+
+	//the timeframes to reindex of an asset parsed from archives are indexed in a single scan
+	//if the batch can't be queued, the timeframes are indexed one by one below
+	batched := []time.Duration{}
+	if !asset.ParsedAddress().HasDependencies() && !setlib.IsBarAsset(asset.Type()) {
+		toReindex, err := asset.GetTimeFrameToReindex()
+		if err != nil {
+			return err
+		}
+		//the minimum timeframe is parsed, not indexed
+		toReindex = lo.Filter(toReindex, func(tf time.Duration, _ int) bool {
+			return tf > pcommon.Env.MIN_TIME_FRAME
+		})
+		if len(toReindex) > 1 {
+			if err := Engine.AddTimeframesIndexing(asset, toReindex); err != nil {
+				util.AssetLog(asset.Address()).WithField("error", err.Error()).Error("Error queuing the timeframes indexing")
+			} else {
+				batched = toReindex
+			}
+		}
+	}
+
+	//smaller timeframes first, they can be the source of the larger ones
+	timeframes := asset.SetRef.GetAllAssetsTimeframes()
+	sort.Slice(timeframes, func(i, j int) bool {
+		return timeframes[i] < timeframes[j]
+	})
+	for _, tf := range timeframes {
+		if lo.Contains(batched, tf) {
+			continue
+		}
 		Engine.AddTimeframeIndexing(asset, tf)
 	}
 	return nil
@@ -1,7 +1,10 @@
 package engine
 
 import (
+	"io"
 	"math"
+	"pendulev2/formula"
+	"pendulev2/script"
 	"pendulev2/set2"
 	setlib "pendulev2/set2"
 	"reflect"
@@ -76,23 +79,22 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 			return err
 		}
 
+		alignment := asset.TimeframeAlignment(timeframe)
 		var t0, t1 pcommon.TimeUnit
 		//if there is no previous indexing
 		if prevT1 == 0 {
 			//we build the initial candle range
-			t0Time, t1Time := buildInitialCandleRange(asset.DataHistoryTime0().ToTime(), timeframe)
-			t0 = pcommon.NewTimeUnitFromTime(t0Time)
-			t1 = pcommon.NewTimeUnitFromTime(t1Time)
+			t0, t1 = alignment.FirstCandle(asset.DataHistoryTime0())
 			//we instantiate the previous list
 			for index, dep := range asset.DependenciesRef {
-				prevList[index] = pcommon.NewTypeTimeArray(dep.DataType())
+				prevList[index] = pcommon.NewTypeTimeArray(dep.ReadDataType())
 			}
 
 			//if there is a previous indexing
 		} else {
 			//we set the previous indexing date to t0
 			t0 = prevT1
-			t1 = t0.Add(timeframe)
+			t1 = alignment.Next(t0)
 
 			//we get the previous ticks for each dependency, in case we need to cumulate them
 			for index, dep := range asset.DependenciesRef {
@@ -100,13 +102,13 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 					TimeFrame:      timeframe,
 					Limit:          10,
 					StartByEnd:     true,
-					OffsetUnixTime: t0.Add(timeframe),
+					OffsetUnixTime: alignment.Next(t0),
 				}
 				ticks, err := dep.GetDataLimit(settings, false)
 				if err != nil {
 					return err
 				}
-				prevList[index] = ticks
+				prevList[index] = dep.ReadList(ticks)
 			}
 		}
 
@@ -115,12 +117,39 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 		runner.SetSize().Max(minLastDependenciesTime.Int())
 
 		//we build the indicator data builder
-		indicatorDataBuilder := pcommon.NewIndicatorDataBuilder(asset.Type(), prevState.State(), asset.ParsedAddress().Arguments, asset.Decimals())
+		indicatorDataBuilder, err := newIndicatorDataBuilder(asset, prevState.State())
+		if err != nil {
+			return err
+		}
+		if closer, ok := indicatorDataBuilder.(io.Closer); ok {
+			defer closer.Close()
+		}
 
 		for t1 <= minLastDependenciesTime {
 			batch := pcommon.PointTimeArray{}
 			currentList := make([]pcommon.DataList, len(asset.DependenciesRef))
 
+			//the aligned ticks waiting to be computed, they are computed at once when the day changes and at the end of the window
+			pending := [][]pcommon.Data{}
+			pendingTimes := []pcommon.TimeUnit{}
+			computePending := func() error {
+				points, err := computeIndicatorBatch(indicatorDataBuilder, pending)
+				if err != nil {
+					return err
+				}
+				for i, p := range points {
+					//a nil point is a tick without value, it is neither stored nor counted in the min and max
+					if p != nil {
+						prevState.CheckUpdateMin(p.Value, pendingTimes[i])
+						prevState.CheckUpdateMax(p.Value, pendingTimes[i])
+						batch = append(batch, p.ToTime(pendingTimes[i]))
+					}
+				}
+				pending = [][]pcommon.Data{}
+				pendingTimes = []pcommon.TimeUnit{}
+				return nil
+			}
+
 			//we get the ticks for each dependency
 			for index, dep := range asset.DependenciesRef {
 
@@ -132,14 +161,14 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 				maxTickCount := int(math.Min(float64(maxBatchSize), float64(MAX_BATCH_SIZE)))
 
 				//we calculate the end of the interval
-				t1 = t0.Add(timeframe * time.Duration(maxTickCount))
+				t1 = alignment.Advance(t0, maxTickCount)
 
 				//we get the ticks between t0 and newT1
 				ticks, err := dep.GetInDataRange(t0, t1.Add(time.Millisecond), timeframe, nil, nil, false)
 				if err != nil {
 					return err
 				}
-				currentList[index] = ticks
+				currentList[index] = dep.ReadList(ticks)
 			}
 
 			for {
@@ -193,18 +222,16 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 
 				//if we have cumulated all the data
 				if len(dataToCumulate) == len(asset.DependenciesRef) {
-					p, err := indicatorDataBuilder.ComputeUnsafe(dataToCumulate...)
-					if err != nil {
-						return err
-					}
-					prevState.CheckUpdateMin(p.Value, earliestTime)
-					prevState.CheckUpdateMax(p.Value, earliestTime)
-					batch = append(batch, p.ToTime(earliestTime))
+					pending = append(pending, dataToCumulate)
+					pendingTimes = append(pendingTimes, earliestTime)
 
 					currentDate := pcommon.Format.FormatDateStr(earliestTime.ToTime())
-					nextDate := pcommon.Format.FormatDateStr(earliestTime.Add(timeframe).ToTime())
+					nextDate := pcommon.Format.FormatDateStr(alignment.Next(earliestTime).ToTime())
 
 					if currentDate != nextDate {
+						if err := computePending(); err != nil {
+							return err
+						}
 						prevState.UpdateState(indicatorDataBuilder.PrevState())
 						if err := asset.Store(batch.ToRaw(asset.Decimals()), timeframe, prevState.Copy(), earliestTime); err != nil {
 							return err
@@ -215,6 +242,9 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 				}
 			}
 
+			if err := computePending(); err != nil {
+				return err
+			}
 			if batch.Len() > 0 {
 				prevState.UpdateState(indicatorDataBuilder.PrevState())
 				if err := asset.Store(batch.ToRaw(asset.Decimals()), timeframe, prevState.Copy(), t1); err != nil {
@@ -228,7 +258,7 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 			}
 
 			t0 = t1
-			t1 = t1.Add(timeframe)
+			t1 = alignment.Next(t1)
 			runner.SetSize().Current(t0.Int(), false)
 		}
 		runner.AddStep()
@@ -239,6 +269,59 @@ func addIndicatorIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 	runner.AddProcess(process)
 }
 
+type indicatorBuilder interface {
+	ComputeUnsafe(dataList ...pcommon.Data) (*pcommon.Point, error)
+	PrevState() []byte
+}
+
+// batchIndicatorBuilder is a builder computing many ticks at once (eg: the scripts, in one round trip to their worker).
+type batchIndicatorBuilder interface {
+	ComputeBatchUnsafe(batch [][]pcommon.Data) ([]*pcommon.Point, error)
+}
+
+// computeIndicatorBatch returns the point of each entry of the batch, nil if the tick has no value.
+func computeIndicatorBatch(builder indicatorBuilder, batch [][]pcommon.Data) ([]*pcommon.Point, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	if b, ok := builder.(batchIndicatorBuilder); ok {
+		return b.ComputeBatchUnsafe(batch)
+	}
+	points := make([]*pcommon.Point, len(batch))
+	for i, dataList := range batch {
+		p, err := builder.ComputeUnsafe(dataList...)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = p
+	}
+	return points, nil
+}
+
+// newIndicatorDataBuilder returns the builder of the pendule-common indicators, or of the formula and script assets.
+func newIndicatorDataBuilder(asset *setlib.AssetState, prevState []byte) (indicatorBuilder, error) {
+	address := asset.ParsedAddress()
+	if setlib.IsFormulaAsset(asset.Type()) {
+		return formula.NewBuilder(address.Arguments[0], len(address.Dependencies), prevState, asset.Decimals())
+	}
+	if setlib.IsScriptAsset(asset.Type()) {
+		return script.NewBuilder(address.Arguments[0], address.Arguments[1], prevState, asset.Decimals())
+	}
+	return pcommon.NewIndicatorDataBuilder(asset.Type(), prevState, address.Arguments, asset.Decimals()), nil
+}
+
+// scriptChanged returns true if the script of a script asset changed since the asset was computed.
+func scriptChanged(asset *setlib.AssetState) (bool, error) {
+	if !setlib.IsScriptAsset(asset.Type()) {
+		return false, nil
+	}
+	prevState, err := asset.GetLastPrevStateCached(pcommon.Env.MIN_TIME_FRAME)
+	if err != nil {
+		return false, err
+	}
+	return script.Changed(asset.ParsedAddress().Arguments[0], prevState.State())
+}
+
 func getDepAddresses(address pcommon.AssetAddress) []pcommon.AssetAddress {
 	ret := []pcommon.AssetAddress{}
 	p, _ := address.Parse()
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"errors"
+	"pendulev2/metrics"
+	"pendulev2/util"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	JOB_STATUS_QUEUED     = "queued"     //waiting for the scheduler
+	JOB_STATUS_PAUSED     = "paused"     //held until resumed
+	JOB_STATUS_DISPATCHED = "dispatched" //waiting in the runner engine
+	JOB_STATUS_RUNNING    = "running"
+	JOB_STATUS_STOPPING   = "stopping"  //paused or cancelled while running, stopping at its next safe point
+	JOB_STATUS_SUSPENDED  = "suspended" //stopped while running as the disk is critical, queued again once it is back
+)
+
+var ErrJobNotPausable = errors.New("the job can't be rebuilt once stopped, it can only be cancelled")
+
+var STAT_VALUES = []string{STAT_VALUE_ARCHIVE_SIZE, STAT_VALUE_DATA_COUNT, STAT_VALUE_LINE_COUNT}
+
+type JobInfo struct {
+	ID         string                 `json:"id"`
+	Kind       string                 `json:"kind"`
+	Status     string                 `json:"status"`
+	Phase      RunnerPhase            `json:"phase"`
+	Priority   Priority               `json:"priority"`
+	Addresses  []pcommon.AssetAddress `json:"addresses"`
+	Timeframes []int64                `json:"timeframes"` //in milliseconds
+	Date       string                 `json:"date,omitempty"`
+	Steps      int                    `json:"steps"`
+	Percent    float64                `json:"percent"`
+	ETA        int64                  `json:"eta"`        //in milliseconds
+	StartedAt  int64                  `json:"started_at"` //in milliseconds, 0 if not started
+	Retries    int                    `json:"retries"`
+	Stats      map[string]int64       `json:"stats"`
+}
+
+// info returns the details of a job, the caller holds the lock of the queue.
+func (j *job) info() JobInfo {
+	r := j.runner
+	info := JobInfo{
+		ID:         j.descriptor.ID,
+		Kind:       j.descriptor.Kind,
+		Phase:      runnerPhase(r),
+		Priority:   j.priority,
+		Addresses:  j.descriptor.Addresses,
+		Timeframes: []int64{},
+		Date:       j.descriptor.Date,
+		Steps:      r.CountSteps(),
+		Percent:    r.Percent(),
+		ETA:        r.ETA().Milliseconds(),
+		Retries:    r.RetryCount(),
+		Stats:      map[string]int64{},
+	}
+	timeframes := j.descriptor.Timeframes
+	if len(timeframes) == 0 && j.descriptor.Timeframe > 0 {
+		timeframes = []time.Duration{j.descriptor.Timeframe}
+	}
+	for _, tf := range timeframes {
+		info.Timeframes = append(info.Timeframes, tf.Milliseconds())
+	}
+	if r.HasStarted() {
+		info.StartedAt = r.StartedAt().UnixMilli()
+	}
+	for _, key := range STAT_VALUES {
+		if v := r.StatValue(key); v != 0 {
+			info.Stats[key] = v
+		}
+	}
+
+	switch {
+	case r.IsRunning() && r.MustInterrupt(), j.resuming:
+		info.Status = JOB_STATUS_STOPPING
+	case j.descriptor.Paused:
+		info.Status = JOB_STATUS_PAUSED
+	case j.suspended:
+		info.Status = JOB_STATUS_SUSPENDED
+	case r.IsRunning():
+		info.Status = JOB_STATUS_RUNNING
+	case j.dispatched:
+		info.Status = JOB_STATUS_DISPATCHED
+	default:
+		info.Status = JOB_STATUS_QUEUED
+	}
+	return info
+}
+
+// updateQueueMetrics counts the jobs of the queue by status.
+func (e *engine) updateQueueMetrics() {
+	counts := map[string]int{
+		JOB_STATUS_QUEUED:     0,
+		JOB_STATUS_PAUSED:     0,
+		JOB_STATUS_DISPATCHED: 0,
+		JOB_STATUS_RUNNING:    0,
+		JOB_STATUS_STOPPING:   0,
+		JOB_STATUS_SUSPENDED:  0,
+	}
+	for _, info := range e.ListJobs() {
+		counts[info.Status]++
+	}
+	for status, count := range counts {
+		metrics.QueueDepth.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+// ListJobs returns the queued and running jobs in the order they were queued.
+func (e *engine) ListJobs() []JobInfo {
+	list := []JobInfo{}
+	for _, j := range e.queue.list() {
+		e.queue.mu.Lock()
+		list = append(list, j.info())
+		e.queue.mu.Unlock()
+	}
+	return list
+}
+
+func (e *engine) GetJob(id string) (*JobInfo, error) {
+	e.queue.mu.Lock()
+	defer e.queue.mu.Unlock()
+	j, ok := e.queue.jobs[id]
+	if !ok {
+		return nil, util.ErrJobNotFound
+	}
+	info := j.info()
+	return &info, nil
+}
+
+// withdraw takes a dispatched job back from the runner engine, a running one being interrupted at its next safe point.
+func (e *engine) withdraw(j *job) {
+	if j.dispatched {
+		e.Engine.Cancel(j.runner)
+		j.dispatched = false
+	}
+}
+
+// waitStopped returns once a runner taken back from the runner engine reached its next safe point.
+func waitStopped(r *gorunner.Runner) {
+	for r.IsRunning() {
+		time.Sleep(time.Second)
+	}
+}
+
+// cancelled records a job removed from the queue, the abort function of a job that can't be rebuilt being called once its runner stopped.
+func (e *engine) cancelled(j *job) {
+	e.recordFinished(j.runner, JOB_OUTCOME_CANCELLED)
+	if j.abort != nil {
+		go func() {
+			waitStopped(j.runner)
+			j.abort()
+		}()
+	}
+}
+
+// PauseJob holds a job until it is resumed, a running job stops at its next safe point and starts over from there once resumed.
+func (e *engine) PauseJob(id string) error {
+	e.dispatchMu.Lock()
+	e.queue.mu.Lock()
+	j, ok := e.queue.jobs[id]
+	if ok && j.abort != nil {
+		e.queue.mu.Unlock()
+		e.dispatchMu.Unlock()
+		return ErrJobNotPausable
+	}
+	if ok {
+		e.withdraw(j)
+		j.descriptor.Paused = true
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+	e.dispatchMu.Unlock()
+	if !ok {
+		return util.ErrJobNotFound
+	}
+	e.dispatch()
+	return nil
+}
+
+/*
+ResumeJob queues again a paused job, a job paused while running being rebuilt to resume from its last safe point.
+The rebuilt job must not run alongside the stopping runner, so it is listed as stopping until the runner stopped and it is queued again.
+*/
+func (e *engine) ResumeJob(id string) error {
+	e.queue.mu.Lock()
+	j, ok := e.queue.jobs[id]
+	if !ok {
+		e.queue.mu.Unlock()
+		return util.ErrJobNotFound
+	}
+	j.descriptor.Paused = false
+	started := j.runner.HasStarted()
+	resuming := j.resuming
+	j.resuming = started
+	e.queue.save()
+	e.queue.mu.Unlock()
+
+	if started && !resuming {
+		go e.rebuildStopped(j)
+	}
+	e.dispatch()
+	return nil
+}
+
+// rebuildStopped queues again a resumed job once its runner stopped, unless it was paused or cancelled meanwhile.
+func (e *engine) rebuildStopped(j *job) {
+	waitStopped(j.runner)
+
+	e.queue.mu.Lock()
+	j.resuming = false
+	current, ok := e.queue.jobs[j.descriptor.ID]
+	replay := ok && current == j && !j.descriptor.Paused
+	if replay {
+		delete(e.queue.jobs, j.descriptor.ID)
+		e.queue.save()
+	}
+	descriptor := j.descriptor
+	e.queue.mu.Unlock()
+	if !replay {
+		return
+	}
+
+	if err := e.replay(descriptor); err != nil && err != util.ErrAlreadySync {
+		log.WithFields(log.Fields{
+			util.LOG_FIELD_RUNNER: descriptor.ID,
+			"error":               err.Error(),
+		}).Warn("Job not resumed")
+	}
+	e.dispatch()
+}
+
+// CancelJob removes a job from the queue, a running job stops at its next safe point.
+func (e *engine) CancelJob(id string) error {
+	e.dispatchMu.Lock()
+	e.queue.mu.Lock()
+	j, ok := e.queue.jobs[id]
+	if ok {
+		e.withdraw(j)
+		delete(e.queue.jobs, id)
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+	e.dispatchMu.Unlock()
+	if !ok {
+		return util.ErrJobNotFound
+	}
+	e.cancelled(j)
+	e.dispatch()
+	return nil
+}
+
+// CancelAssetJobs cancels the jobs reading or writing the asset of the given address, and returns once their runners stopped.
+func (e *engine) CancelAssetJobs(address pcommon.AssetAddress) {
+	e.dispatchMu.Lock()
+	e.queue.mu.Lock()
+	jobs := []*job{}
+	for id, j := range e.queue.jobs {
+		if lo.Contains(j.descriptor.Addresses, address) {
+			e.withdraw(j)
+			delete(e.queue.jobs, id)
+			jobs = append(jobs, j)
+		}
+	}
+	if len(jobs) > 0 {
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+	e.dispatchMu.Unlock()
+
+	for _, j := range jobs {
+		e.cancelled(j)
+		waitStopped(j.runner)
+	}
+	e.dispatch()
+}
+
+// ReprioritizeJob overrides the priority of a job, a job waiting in the runner engine going back to the scheduler.
+func (e *engine) ReprioritizeJob(id string, priority Priority) error {
+	e.dispatchMu.Lock()
+	e.queue.mu.Lock()
+	j, ok := e.queue.jobs[id]
+	if ok {
+		if !j.runner.HasStarted() {
+			e.withdraw(j)
+		}
+		j.priority = priority
+		j.descriptor.Priority = &priority
+		e.queue.save()
+	}
+	e.queue.mu.Unlock()
+	e.dispatchMu.Unlock()
+	if !ok {
+		return util.ErrJobNotFound
+	}
+	e.dispatch()
+	return nil
+}
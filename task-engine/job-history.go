@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pendulev2/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+const JOB_HISTORY_FILE = "job-history.jsonl"
+
+// JOB_HISTORY_SIZE_ENV sets the number of finished runners kept in the history.
+const JOB_HISTORY_SIZE_ENV = "JOB_HISTORY_SIZE"
+
+const DEFAULT_JOB_HISTORY_SIZE = 1000
+
+const (
+	JOB_OUTCOME_SUCCEEDED = "succeeded"
+	JOB_OUTCOME_FAILED    = "failed"
+	JOB_OUTCOME_CANCELLED = "cancelled"
+)
+
+// JobRecord is a runner that is done, failed for good or cancelled.
+type JobRecord struct {
+	ID         string                 `json:"id"`
+	Kind       string                 `json:"kind"`
+	Outcome    string                 `json:"outcome"`
+	Addresses  []pcommon.AssetAddress `json:"addresses"`
+	Timeframes []int64                `json:"timeframes"` //in milliseconds
+	Date       string                 `json:"date,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	StartedAt  int64                  `json:"started_at"`  //in milliseconds, 0 if it never started
+	FinishedAt int64                  `json:"finished_at"` //in milliseconds
+	Duration   int64                  `json:"duration"`    //in milliseconds
+	Rows       int64                  `json:"rows"`
+	Retries    int                    `json:"retries"`
+}
+
+func newJobRecord(r *gorunner.Runner, outcome string) JobRecord {
+	status := GetRunnerStatus(r)
+	date, _ := gorunner.GetArg[string](r.Args, ARG_VALUE_DATE)
+	record := JobRecord{
+		ID:         r.ID,
+		Kind:       status.Kind,
+		Outcome:    outcome,
+		Addresses:  status.Addresses,
+		Timeframes: status.Timeframes,
+		Date:       date,
+		Error:      status.Error,
+		FinishedAt: time.Now().UnixMilli(),
+		Rows:       status.Rows,
+		Retries:    status.Retries,
+	}
+	if r.HasStarted() {
+		record.StartedAt = r.StartedAt().UnixMilli()
+		record.Duration = r.Timer().Milliseconds()
+	}
+	return record
+}
+
+/*
+jobHistory keeps the last finished runners, appended to a JSON lines file.
+The file is rewritten with the records kept once it holds twice as many lines, so it stays bounded.
+*/
+type jobHistory struct {
+	mu      sync.Mutex
+	path    string
+	size    int
+	records []JobRecord
+	lines   int //lines of the file
+}
+
+func newJobHistory(path string) (*jobHistory, error) {
+	h := &jobHistory{path: path, size: DEFAULT_JOB_HISTORY_SIZE}
+	if env := os.Getenv(JOB_HISTORY_SIZE_ENV); env != "" {
+		size, err := strconv.Atoi(env)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("%s: invalid value %q", JOB_HISTORY_SIZE_ENV, env)
+		}
+		h.size = size
+	}
+	return h, nil
+}
+
+func jobHistoryFilePath() string {
+	return filepath.Join(pcommon.Env.DATABASES_DIR, JOB_HISTORY_FILE)
+}
+
+// load reads the records of a previous run, the lines that can't be decoded are skipped.
+func (h *jobHistory) load() error {
+	file, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		h.lines++
+		record := JobRecord{}
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			h.records = append(h.records, record)
+		}
+	}
+	if len(h.records) > h.size {
+		h.records = h.records[len(h.records)-h.size:]
+	}
+	return scanner.Err()
+}
+
+func (h *jobHistory) add(record JobRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, record)
+	if len(h.records) > h.size {
+		h.records = h.records[len(h.records)-h.size:]
+	}
+
+	var err error
+	if h.lines+1 > 2*h.size {
+		err = h.rewrite()
+	} else {
+		err = h.append(record)
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error saving the job history")
+	}
+}
+
+func (h *jobHistory) append(record JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.lines++
+	return nil
+}
+
+// rewrite writes the records kept in a temporary file first, so a crash can't leave a truncated file.
+func (h *jobHistory) rewrite() error {
+	data := []byte{}
+	for _, record := range h.records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	h.lines = len(h.records)
+	return nil
+}
+
+// recordFinished adds a runner that is done, failed for good or cancelled to the history and the metrics.
+func (e *engine) recordFinished(r *gorunner.Runner, outcome string) {
+	record := newJobRecord(r, outcome)
+	e.history.add(record)
+	lastFinish.Store(time.Now().UnixNano())
+	if outcome == JOB_OUTCOME_FAILED {
+		runnerLog(r).WithFields(log.Fields{
+			"error":   record.Error,
+			"retries": record.Retries,
+		}).Error("Runner failed")
+	}
+	if r.HasStarted() {
+		metrics.RunnerDuration.WithLabelValues(record.Kind, outcome).Observe(r.Timer().Seconds())
+	}
+}
+
+// JobHistoryFilter selects records of the history, its empty fields match all the records.
+type JobHistoryFilter struct {
+	Kind    string               `json:"kind"`
+	Outcome string               `json:"outcome"`
+	Address pcommon.AssetAddress `json:"address"`
+	Date    string               `json:"date"`
+	Limit   int                  `json:"limit"`
+}
+
+func (f JobHistoryFilter) match(record JobRecord) bool {
+	return (f.Kind == "" || record.Kind == f.Kind) &&
+		(f.Outcome == "" || record.Outcome == f.Outcome) &&
+		(f.Address == "" || lo.Contains(record.Addresses, f.Address)) &&
+		(f.Date == "" || record.Date == f.Date)
+}
+
+// JobHistory returns the records matching the filter, the most recent first.
+func (e *engine) JobHistory(filter JobHistoryFilter) []JobRecord {
+	e.history.mu.Lock()
+	defer e.history.mu.Unlock()
+	list := []JobRecord{}
+	for i := len(e.history.records) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(list) >= filter.Limit {
+			break
+		}
+		if filter.match(e.history.records[i]) {
+			list = append(list, e.history.records[i])
+		}
+	}
+	return list
+}
@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	setlib "pendulev2/set2"
+	"pendulev2/util"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+const JOBS_FILE = "jobs.json"
+
+/*
+JobDescriptor is what is needed to rebuild a queued runner after a restart.
+The runners are rebuilt through the same methods that queued them, which recompute what is left to do,
+so replaying a job that had already run, even partially, is harmless.
+*/
+type JobDescriptor struct {
+	ID         string                 `json:"id"`
+	Kind       string                 `json:"kind"`
+	Addresses  []pcommon.AssetAddress `json:"addresses"`
+	Timeframe  time.Duration          `json:"timeframe"`
+	Timeframes []time.Duration        `json:"timeframes,omitempty"`
+	Date       string                 `json:"date,omitempty"`
+	CSV        *setlib.CSVOrderPacked `json:"csv,omitempty"`
+	Priority   *Priority              `json:"priority,omitempty"` //set if the priority of the class is overridden
+	Paused     bool                   `json:"paused,omitempty"`
+	Prepared   bool                   `json:"prepared,omitempty"` //indexes an asset not added to its set yet
+	Sequence   uint64                 `json:"sequence"`
+}
+
+type job struct {
+	runner     *gorunner.Runner
+	descriptor JobDescriptor
+	priority   Priority
+	setID      string
+	dispatched bool   //handed to the runner engine
+	memory     int64  //estimated before the runner starts
+	suspended  bool   //stopped while running as the disk is critical, rebuilt once it is back
+	resuming   bool   //resumed while its runner was running, rebuilt once it stopped
+	abort      func() //set for the jobs that can't be rebuilt, called once the job is cancelled or interrupted and its runner stopped
+}
+
+/*
+jobQueue keeps the runners queued or running in the engine, and persists their descriptors in a JSON file.
+The runners wait in the queue until the scheduler hands them to the runner engine.
+*/
+type jobQueue struct {
+	mu       sync.Mutex
+	path     string
+	sequence uint64
+	jobs     map[string]*job
+
+	lastDispatch map[string]uint64 //set ID -> dispatch count when the set was last served
+	dispatches   uint64
+
+	pausing bool //set while a paused job is restored, the jobs pushed meanwhile are paused
+}
+
+func newJobQueue(path string) *jobQueue {
+	return &jobQueue{
+		path:         path,
+		jobs:         make(map[string]*job),
+		lastDispatch: make(map[string]uint64),
+	}
+}
+
+// runnerKind returns the key prefixing the ID of a runner.
+func runnerKind(r *gorunner.Runner) string {
+	for _, kind := range []string{STATE_PARSING_KEY, DAY_REPARSING_KEY, STATE_ROLLBACK_KEY, TIMEFRAME_INDEXING_KEY, CSV_BUILDING_KEY} {
+		if strings.HasPrefix(r.ID, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+func newJobDescriptor(r *gorunner.Runner) JobDescriptor {
+	d := JobDescriptor{ID: r.ID, Kind: runnerKind(r)}
+	d.Addresses, _ = gorunner.GetArg[[]pcommon.AssetAddress](r.Args, ARG_VALUE_ADDRESSES)
+	d.Timeframe, _ = gorunner.GetArg[time.Duration](r.Args, ARG_VALUE_TIMEFRAME)
+	d.Timeframes, _ = gorunner.GetArg[[]time.Duration](r.Args, ARG_VALUE_TIMEFRAMES)
+	d.Date, _ = gorunner.GetArg[string](r.Args, ARG_VALUE_DATE)
+	d.Prepared, _ = gorunner.GetArg[bool](r.Args, ARG_VALUE_PREPARED)
+	if p, ok := gorunner.GetArg[Priority](r.Args, ARG_VALUE_PRIORITY); ok {
+		d.Priority = &p
+	}
+	if parameters, ok := gorunner.GetArg[*setlib.CSVOrderUnpacked](r.Args, ARG_VALUE_PARAMETERS); ok {
+		packed := parameters.Pack()
+		d.CSV = &packed
+	}
+	return d
+}
+
+// push adds a runner to the queue, it returns false if a runner with the same ID is already queued or running.
+func (q *jobQueue) push(r *gorunner.Runner, memory int64, abort func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	//an interrupted runner never calls back
+	if j, ok := q.jobs[r.ID]; ok && !j.runner.MustInterrupt() {
+		return false
+	}
+	q.sequence++
+	d := newJobDescriptor(r)
+	d.Sequence = q.sequence
+	d.Paused = q.pausing
+	j := &job{runner: r, descriptor: d, priority: getPriority(r), memory: memory, abort: abort}
+	if len(d.Addresses) > 0 {
+		if parsed, err := d.Addresses[0].Parse(); err == nil {
+			j.setID = parsed.IDString()
+		}
+	}
+	q.jobs[r.ID] = j
+	q.save()
+	return true
+}
+
+func (q *jobQueue) count() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// remove drops a runner that is done, failed for good or cancelled.
+func (q *jobQueue) remove(r *gorunner.Runner) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j, ok := q.jobs[r.ID]; ok && j.runner == r {
+		delete(q.jobs, r.ID)
+		q.save()
+	}
+}
+
+// list returns the jobs in the order they were queued.
+func (q *jobQueue) list() []*job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := lo.Values(q.jobs)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].descriptor.Sequence < list[j].descriptor.Sequence
+	})
+	return list
+}
+
+// save writes the descriptors of the queue, the caller holds the lock.
+func (q *jobQueue) save() {
+	descriptors := lo.Map(lo.Values(q.jobs), func(j *job, _ int) JobDescriptor {
+		return j.descriptor
+	})
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Sequence < descriptors[j].Sequence
+	})
+	data, err := json.MarshalIndent(descriptors, "", "  ")
+	if err == nil {
+		//written in a temporary file first, so a crash can't leave a truncated file
+		tmp := q.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, q.path)
+		}
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error saving the job queue")
+	}
+}
+
+// load reads the descriptors saved by a previous run, in the order they were queued.
+func (q *jobQueue) load() ([]JobDescriptor, error) {
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	descriptors := []JobDescriptor{}
+	if err := json.Unmarshal(data, &descriptors); err != nil {
+		return nil, err
+	}
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Sequence < descriptors[j].Sequence
+	})
+	return descriptors, nil
+}
+
+func jobsFilePath() string {
+	return filepath.Join(pcommon.Env.DATABASES_DIR, JOBS_FILE)
+}
+
+func (e *engine) findAsset(address pcommon.AssetAddress) (*setlib.AssetState, error) {
+	parsed, err := address.Parse()
+	if err != nil {
+		return nil, err
+	}
+	set := e.Sets.Find(parsed.IDString())
+	if set == nil {
+		return nil, util.ErrSetNotFound
+	}
+	asset := set.Asset(address)
+	if asset == nil {
+		return nil, util.ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// replay queues again the runner described by d.
+func (e *engine) replay(d JobDescriptor) error {
+	if d.Kind == CSV_BUILDING_KEY {
+		if d.CSV == nil {
+			return errors.New("missing CSV parameters")
+		}
+		return e.addCSVBuilding(*d.CSV, d.Priority)
+	}
+	if len(d.Addresses) == 0 {
+		return errors.New("missing asset address")
+	}
+	if d.Prepared {
+		return e.dropPreparedAsset(d.Addresses[0])
+	}
+	asset, err := e.findAsset(d.Addresses[0])
+	if err != nil {
+		return err
+	}
+
+	switch d.Kind {
+	case STATE_PARSING_KEY:
+		return e.AddStateParsing(asset)
+	case DAY_REPARSING_KEY:
+		return e.AddDayReparsing(asset, d.Date, d.Priority)
+	case STATE_ROLLBACK_KEY:
+		r := buildStateRollbackRunner(asset, d.Date, d.Timeframe)
+		setPriority(r, d.Priority)
+		e.Add(r)
+		return nil
+	case TIMEFRAME_INDEXING_KEY:
+		if len(d.Timeframes) > 1 {
+			return e.AddTimeframesIndexing(asset, d.Timeframes)
+		}
+		//the minimum timeframe of the assets computed from others is indexed like the archives are parsed
+		if d.Timeframe <= pcommon.Env.MIN_TIME_FRAME {
+			return e.AddStateParsing(asset)
+		}
+		return e.AddTimeframeIndexing(asset, d.Timeframe)
+	}
+	return fmt.Errorf("unknown job kind %q", d.Kind)
+}
+
+// dropPreparedAsset deletes the data of an asset whose indexing was interrupted before it was added to its set, as nothing is left to add it.
+func (e *engine) dropPreparedAsset(address pcommon.AssetAddress) error {
+	parsed, err := address.Parse()
+	if err != nil {
+		return err
+	}
+	set := e.Sets.Find(parsed.IDString())
+	if set == nil {
+		return util.ErrSetNotFound
+	}
+	if err := set.DeleteOrphanAssetData(address); err != nil {
+		return err
+	}
+	return errors.New("the asset was not added to its set, its data is deleted")
+}
+
+/*
+RestoreJobs queues again, in their original order, the runners that were queued or running when the process stopped.
+It is called once the sets are loaded, before their tasks are scheduled.
+*/
+func (e *engine) RestoreJobs() {
+	descriptors, err := e.queue.load()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error loading the job queue")
+		return
+	}
+
+	restored := 0
+	for _, d := range descriptors {
+		//a paused job is pushed paused, so it is never dispatched, whatever the ID of its rebuilt runner
+		e.queue.mu.Lock()
+		e.queue.pausing = d.Paused
+		e.queue.mu.Unlock()
+		err := e.replay(d)
+		e.queue.mu.Lock()
+		e.queue.pausing = false
+		e.queue.mu.Unlock()
+		if err != nil && err != util.ErrAlreadySync {
+			log.WithFields(log.Fields{
+				util.LOG_FIELD_RUNNER: d.ID,
+				"error":               err.Error(),
+			}).Warn("Job not restored")
+			continue
+		}
+		restored++
+	}
+	//the jobs that were not restored are dropped
+	e.queue.mu.Lock()
+	e.queue.save()
+	e.queue.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"restored": restored,
+		"total":    len(descriptors),
+	}).Info("Job queue restored")
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ENGINE_STALL_TIMEOUT_ENV sets how long the running runners can go without progress before the engine is considered stalled, e.g. "15m".
+const ENGINE_STALL_TIMEOUT_ENV = "ENGINE_STALL_TIMEOUT"
+
+const DEFAULT_ENGINE_STALL_TIMEOUT = 15 * time.Minute
+
+var engineStallTimeout = DEFAULT_ENGINE_STALL_TIMEOUT
+
+// the last time a runner finished, in unix nanoseconds
+var lastFinish atomic.Int64
+
+func initLiveness() error {
+	if env := os.Getenv(ENGINE_STALL_TIMEOUT_ENV); env != "" {
+		timeout, err := time.ParseDuration(env)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("%s: invalid value %q", ENGINE_STALL_TIMEOUT_ENV, env)
+		}
+		engineStallTimeout = timeout
+	}
+	return nil
+}
+
+type EngineLiveness struct {
+	Running      int   `json:"running"`
+	Queued       int   `json:"queued"`
+	LastProgress int64 `json:"last_progress"` //in milliseconds, 0 if no runner progressed yet
+	Stalled      bool  `json:"stalled"`       //runners are running without progress for too long
+}
+
+/*
+Liveness returns the last time a runner progressed: its size or steps moved forward, or it finished.
+The engine is stalled if runners are running and none progressed within ENGINE_STALL_TIMEOUT.
+*/
+func (e *engine) Liveness() EngineLiveness {
+	running := e.RunningRunners()
+	last := time.Unix(0, lastFinish.Load())
+	for _, r := range running {
+		if t := r.LastProgress(); t.After(last) {
+			last = t
+		}
+		if t := r.LastStep(); t.After(last) {
+			last = t
+		}
+	}
+
+	liveness := EngineLiveness{
+		Running: len(running),
+		Queued:  e.CountQueued(),
+	}
+	if last.UnixNano() > 0 {
+		liveness.LastProgress = last.UnixMilli()
+	}
+	liveness.Stalled = len(running) > 0 && time.Since(last) > engineStallTimeout
+	return liveness
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/shirou/gopsutil/v3/mem"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+The resource governor holds the runners back while the memory they are expected to use doesn't fit in the available memory.
+The memory of a parsing is estimated from the size of its archives, the other runners use a fixed amount.
+The memory of the runners that have not allocated it yet, because they have not started or are still reading their archives,
+is deducted from the available memory before admitting another one. A runner is always admitted if the engine is idle.
+*/
+
+// GOVERNOR_MEMORY_FACTOR_ENV sets the memory used by a parsing per byte of its archives.
+const GOVERNOR_MEMORY_FACTOR_ENV = "GOVERNOR_MEMORY_FACTOR"
+
+// GOVERNOR_MEMORY_RESERVE_ENV sets the percentage of the total memory left to the rest of the system.
+const GOVERNOR_MEMORY_RESERVE_ENV = "GOVERNOR_MEMORY_RESERVE"
+
+const (
+	DEFAULT_GOVERNOR_MEMORY_FACTOR  = 8
+	DEFAULT_GOVERNOR_MEMORY_RESERVE = 10
+	DEFAULT_RUNNER_MEMORY           = 64 << 20
+)
+
+type GovernorState struct {
+	CPUCount        int    `json:"cpu_count"`
+	MaxRunners      int    `json:"max_runners"`
+	TotalMemory     uint64 `json:"total_memory"`
+	AvailableMemory uint64 `json:"available_memory"`
+	ReservedMemory  uint64 `json:"reserved_memory"` //left to the rest of the system
+	PendingMemory   int64  `json:"pending_memory"`  //expected to be allocated by the runners in the engine
+	RunningMemory   int64  `json:"running_memory"`  //estimated for the runners running
+	HeldBack        string `json:"held_back"`       //ID of the runner waiting for memory, empty if none
+	HeldBackMemory  int64  `json:"held_back_memory"`
+}
+
+type resourceGovernor struct {
+	mu            sync.Mutex
+	factor        int64
+	reservePct    uint64
+	state         GovernorState
+	memoryUnknown bool
+}
+
+func newResourceGovernor() (*resourceGovernor, error) {
+	g := &resourceGovernor{
+		factor:     DEFAULT_GOVERNOR_MEMORY_FACTOR,
+		reservePct: DEFAULT_GOVERNOR_MEMORY_RESERVE,
+	}
+	if env := os.Getenv(GOVERNOR_MEMORY_FACTOR_ENV); env != "" {
+		factor, err := strconv.ParseInt(env, 10, 64)
+		if err != nil || factor < 1 {
+			return nil, fmt.Errorf("%s: invalid value %q", GOVERNOR_MEMORY_FACTOR_ENV, env)
+		}
+		g.factor = factor
+	}
+	if env := os.Getenv(GOVERNOR_MEMORY_RESERVE_ENV); env != "" {
+		pct, err := strconv.ParseUint(env, 10, 64)
+		if err != nil || pct >= 100 {
+			return nil, fmt.Errorf("%s: invalid value %q", GOVERNOR_MEMORY_RESERVE_ENV, env)
+		}
+		g.reservePct = pct
+	}
+	g.state.CPUCount = runtime.NumCPU()
+	g.state.MaxRunners = pcommon.Env.MAX_SIMULTANEOUS_PARSING
+	return g, nil
+}
+
+func isParsingRunner(r *gorunner.Runner) bool {
+	kind := runnerKind(r)
+	return kind == DAY_REPARSING_KEY || (kind == STATE_PARSING_KEY && isRetried(r))
+}
+
+// estimateMemory returns the memory a runner is expected to use.
+func (e *engine) estimateMemory(r *gorunner.Runner) int64 {
+	if !isParsingRunner(r) {
+		return DEFAULT_RUNNER_MEMORY
+	}
+	asset, err := e.findAsset(getAddresses(r)[0])
+	if err != nil {
+		return DEFAULT_RUNNER_MEMORY
+	}
+	var size int64
+	for _, path := range getArchiveZipPaths(asset, getDate(r)) {
+		if s, err := pcommon.File.GetFileSize(path); err == nil {
+			size += s
+		}
+	}
+	return size*e.governor.factor + DEFAULT_RUNNER_MEMORY
+}
+
+// memory returns the memory a job is expected to use, from the archive size captured by the runner once it started.
+func (g *resourceGovernor) memory(j *job) int64 {
+	if size := j.runner.StatValue(STAT_VALUE_ARCHIVE_SIZE); size > 0 {
+		return size*g.factor + DEFAULT_RUNNER_MEMORY
+	}
+	return j.memory
+}
+
+// hasAllocated returns true if the runner of a job in the engine is expected to have allocated most of its memory.
+func hasAllocated(r *gorunner.Runner) bool {
+	if !r.HasStarted() {
+		return false
+	}
+	//the archives are held in memory once parsed
+	return !isParsingRunner(r) || r.CountSteps() >= 2
+}
+
+// sample reads the memory available, before a dispatch.
+func (g *resourceGovernor) sample() {
+	v, err := mem.VirtualMemory()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.memoryUnknown = err != nil
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Memory unavailable, runners admitted without checking it")
+		return
+	}
+	g.state.TotalMemory = v.Total
+	g.state.AvailableMemory = v.Available
+	g.state.ReservedMemory = v.Total * g.reservePct / 100
+}
+
+// admit returns true if the job fits in the memory left by the jobs in the engine, the caller holds the lock of the queue.
+func (g *resourceGovernor) admit(candidate *job, inEngine []*job) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.state.PendingMemory, g.state.RunningMemory = 0, 0
+	for _, j := range inEngine {
+		if j.runner.IsRunning() {
+			g.state.RunningMemory += g.memory(j)
+		}
+		if !hasAllocated(j.runner) {
+			g.state.PendingMemory += g.memory(j)
+		}
+	}
+
+	need := g.memory(candidate)
+	headroom := int64(g.state.AvailableMemory) - int64(g.state.ReservedMemory) - g.state.PendingMemory
+	if g.memoryUnknown || len(inEngine) == 0 || need <= headroom {
+		if len(inEngine) == 0 && need > headroom && !g.memoryUnknown {
+			runnerLog(candidate.runner).WithFields(log.Fields{
+				"memory":    pcommon.Format.LargeBytesToShortString(need),
+				"available": pcommon.Format.LargeBytesToShortString(headroom),
+			}).Warn("Runner admitted alone, its memory exceeds the headroom")
+		}
+		g.state.HeldBack, g.state.HeldBackMemory = "", 0
+		return true
+	}
+
+	if g.state.HeldBack != candidate.runner.ID {
+		runnerLog(candidate.runner).WithFields(log.Fields{
+			"memory":    pcommon.Format.LargeBytesToShortString(need),
+			"available": pcommon.Format.LargeBytesToShortString(headroom),
+		}).Info("Runner held back until memory is freed")
+	}
+	g.state.HeldBack, g.state.HeldBackMemory = candidate.runner.ID, need
+	return false
+}
+
+// GovernorState returns the memory accounting of the last dispatch.
+func (e *engine) GovernorState() GovernorState {
+	e.governor.mu.Lock()
+	defer e.governor.mu.Unlock()
+	return e.governor.state
+}
@@ -0,0 +1,244 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"pendulev2/util"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+The parsing of a day that failed for good is attempted again after a delay doubling at each failure.
+After JOB_MAX_ATTEMPTS failures the day is quarantined: it is no longer parsed until the quarantine is cleared,
+so the consistency of the asset stays before it.
+*/
+
+const JOB_FAILURES_FILE = "job-failures.json"
+
+// JOB_MAX_ATTEMPTS_ENV sets the number of failed parsings of a day before it is quarantined.
+const JOB_MAX_ATTEMPTS_ENV = "JOB_MAX_ATTEMPTS"
+
+// JOB_RETRY_BACKOFF_ENV sets the delay before parsing a day again after its first failure, e.g. "1m".
+const JOB_RETRY_BACKOFF_ENV = "JOB_RETRY_BACKOFF"
+
+const (
+	DEFAULT_JOB_MAX_ATTEMPTS  = 5
+	DEFAULT_JOB_RETRY_BACKOFF = time.Minute
+	MAX_JOB_RETRY_BACKOFF     = 6 * time.Hour
+)
+
+// DayFailure is a day of an asset whose parsing failed.
+type DayFailure struct {
+	Address     pcommon.AssetAddress `json:"address"`
+	Date        string               `json:"date"`
+	Attempts    int                  `json:"attempts"`
+	LastError   string               `json:"last_error"`
+	LastAttempt int64                `json:"last_attempt"` //in milliseconds
+	NextAttempt int64                `json:"next_attempt"` //in milliseconds, 0 if quarantined
+	Quarantined bool                 `json:"quarantined"`
+}
+
+type retryPolicy struct {
+	mu          sync.Mutex
+	path        string
+	maxAttempts int
+	backoff     time.Duration
+	failures    map[string]*DayFailure
+}
+
+func newRetryPolicy(path string) (*retryPolicy, error) {
+	p := &retryPolicy{
+		path:        path,
+		maxAttempts: DEFAULT_JOB_MAX_ATTEMPTS,
+		backoff:     DEFAULT_JOB_RETRY_BACKOFF,
+		failures:    make(map[string]*DayFailure),
+	}
+	if env := os.Getenv(JOB_MAX_ATTEMPTS_ENV); env != "" {
+		max, err := strconv.Atoi(env)
+		if err != nil || max < 1 {
+			return nil, fmt.Errorf("%s: invalid value %q", JOB_MAX_ATTEMPTS_ENV, env)
+		}
+		p.maxAttempts = max
+	}
+	if env := os.Getenv(JOB_RETRY_BACKOFF_ENV); env != "" {
+		backoff, err := time.ParseDuration(env)
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("%s: invalid value %q", JOB_RETRY_BACKOFF_ENV, env)
+		}
+		p.backoff = backoff
+	}
+	return p, nil
+}
+
+func jobFailuresFilePath() string {
+	return filepath.Join(pcommon.Env.DATABASES_DIR, JOB_FAILURES_FILE)
+}
+
+func failureKey(address pcommon.AssetAddress, date string) string {
+	return string(address) + "/" + date
+}
+
+// isRetried returns true if the failures of the runner count against the day it parses.
+func isRetried(r *gorunner.Runner) bool {
+	_, hasDate := gorunner.GetArg[string](r.Args, ARG_VALUE_DATE)
+	return runnerKind(r) == STATE_PARSING_KEY && hasDate
+}
+
+// check returns an error if the day can't be parsed yet, or at all.
+func (p *retryPolicy) check(address pcommon.AssetAddress, date string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.failures[failureKey(address, date)]
+	if !ok {
+		return nil
+	}
+	if f.Quarantined {
+		return util.ErrQuarantined
+	}
+	if time.Now().UnixMilli() < f.NextAttempt {
+		return util.ErrRetryPending
+	}
+	return nil
+}
+
+// update counts the failure of a runner against the days it parses, or clears them if it succeeded.
+func (p *retryPolicy) update(r *gorunner.Runner) {
+	date := getDate(r)
+	err := r.GetError()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, address := range getAddresses(r) {
+		key := failureKey(address, date)
+		if err == nil {
+			delete(p.failures, key)
+			continue
+		}
+
+		f, ok := p.failures[key]
+		if !ok {
+			f = &DayFailure{Address: address, Date: date}
+			p.failures[key] = f
+		}
+		now := time.Now()
+		f.Attempts++
+		f.LastError = err.Error()
+		f.LastAttempt = now.UnixMilli()
+		f.Quarantined = f.Attempts >= p.maxAttempts
+		f.NextAttempt = 0
+		if !f.Quarantined {
+			backoff := p.backoff << (f.Attempts - 1)
+			if backoff > MAX_JOB_RETRY_BACKOFF || backoff <= 0 {
+				backoff = MAX_JOB_RETRY_BACKOFF
+			}
+			f.NextAttempt = now.Add(backoff).UnixMilli()
+		}
+
+		logger := runnerLog(r).WithFields(log.Fields{
+			util.LOG_FIELD_ASSET: address,
+			"attempts":           f.Attempts,
+			"error":              f.LastError,
+		})
+		if f.Quarantined {
+			logger.Error("Day quarantined")
+		} else {
+			logger.Warn("Day parsing failed, retrying later")
+		}
+	}
+	p.save()
+}
+
+// clear removes the failures of a day, it returns false if there were none.
+func (p *retryPolicy) clear(address pcommon.AssetAddress, date string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := failureKey(address, date)
+	if _, ok := p.failures[key]; !ok {
+		return false
+	}
+	delete(p.failures, key)
+	p.save()
+	return true
+}
+
+// save writes the failures, the caller holds the lock.
+func (p *retryPolicy) save() {
+	data, err := json.MarshalIndent(p.sorted(nil), "", "  ")
+	if err == nil {
+		tmp := p.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, p.path)
+		}
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error saving the job failures")
+	}
+}
+
+func (p *retryPolicy) load() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	failures := []DayFailure{}
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range failures {
+		p.failures[failureKey(failures[i].Address, failures[i].Date)] = &failures[i]
+	}
+	return nil
+}
+
+// sorted returns the failures kept by filter, by address and date, the caller holds the lock.
+func (p *retryPolicy) sorted(filter func(f *DayFailure) bool) []DayFailure {
+	list := []DayFailure{}
+	for _, f := range p.failures {
+		if filter == nil || filter(f) {
+			list = append(list, *f)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Address != list[j].Address {
+			return list[i].Address < list[j].Address
+		}
+		return list[i].Date < list[j].Date
+	})
+	return list
+}
+
+// DayFailures returns the days of the assets of a set whose parsing failed, quarantined or waiting for their next attempt.
+func (e *engine) DayFailures(setID string) []DayFailure {
+	e.retries.mu.Lock()
+	defer e.retries.mu.Unlock()
+	return e.retries.sorted(func(f *DayFailure) bool {
+		parsed, err := f.Address.Parse()
+		return err == nil && parsed.IDString() == setID
+	})
+}
+
+// ClearDayFailure lifts the quarantine or the backoff of a day, so it is parsed again at the next tick.
+func (e *engine) ClearDayFailure(address pcommon.AssetAddress, date string) error {
+	if !e.retries.clear(address, date) {
+		return util.ErrFailureNotFound
+	}
+	if asset, err := e.findAsset(address); err == nil {
+		go e.RunAssetTasks(asset)
+	}
+	return nil
+}
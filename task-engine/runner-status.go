@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+type RunnerPhase string
+
+const (
+	PHASE_SCHEDULED    RunnerPhase = "scheduled"
+	PHASE_UNZIPPING    RunnerPhase = "unzipping"
+	PHASE_PARSING      RunnerPhase = "parsing"
+	PHASE_AGGREGATING  RunnerPhase = "aggregating"
+	PHASE_STORING      RunnerPhase = "storing"
+	PHASE_PATCHING     RunnerPhase = "patching"
+	PHASE_INDEXING     RunnerPhase = "indexing"
+	PHASE_ROLLING_BACK RunnerPhase = "rolling_back"
+	PHASE_WRITING      RunnerPhase = "writing"
+	PHASE_ZIPPING      RunnerPhase = "zipping"
+	PHASE_STOPPING     RunnerPhase = "stopping"
+	PHASE_DONE         RunnerPhase = "done"
+	PHASE_FAILED       RunnerPhase = "failed"
+)
+
+const (
+	THROUGHPUT_UNIT_LINES = "lines/s"
+	// milliseconds of data processed per second
+	THROUGHPUT_UNIT_DATA_TIME = "ms/s"
+)
+
+/*
+RunnerStatus describes the progress of a runner, the clients render it as they see fit.
+Parsing runners progress in archive lines, indexing runners and exports in time of data.
+*/
+type RunnerStatus struct {
+	ID             string                 `json:"id"`
+	Kind           string                 `json:"kind"`
+	Phase          RunnerPhase            `json:"phase"`
+	Addresses      []pcommon.AssetAddress `json:"addresses"`
+	Timeframes     []int64                `json:"timeframes"`             //in milliseconds
+	Date           string                 `json:"date,omitempty"`         //the day parsed or rolled back to
+	CurrentDate    string                 `json:"current_date,omitempty"` //the day being indexed or exported
+	Percent        float64                `json:"percent"`
+	ETA            int64                  `json:"eta"`     //in milliseconds
+	Elapsed        int64                  `json:"elapsed"` //in milliseconds
+	Throughput     float64                `json:"throughput"`
+	ThroughputUnit string                 `json:"throughput_unit,omitempty"`
+	Rows           int64                  `json:"rows"`  //rows stored, or lines written by an export
+	Bytes          int64                  `json:"bytes"` //size of the archive parsed, or of the export
+	Retries        int                    `json:"retries"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+// runnerPhase maps the steps of a runner of each kind to its phase.
+func runnerPhase(r *gorunner.Runner) RunnerPhase {
+	if !r.HasStarted() {
+		return PHASE_SCHEDULED
+	}
+	if r.IsDone() {
+		if r.GetError() != nil {
+			return PHASE_FAILED
+		}
+		return PHASE_DONE
+	}
+	if r.MustInterrupt() {
+		return PHASE_STOPPING
+	}
+
+	steps := r.CountSteps()
+	switch runnerKind(r) {
+	case STATE_PARSING_KEY:
+		switch steps {
+		case 0:
+			return PHASE_UNZIPPING
+		case 1:
+			return PHASE_PARSING
+		case 2:
+			return PHASE_AGGREGATING
+		case 3:
+			return PHASE_STORING
+		}
+	case DAY_REPARSING_KEY:
+		if steps < 3 {
+			return PHASE_PARSING
+		}
+		if steps == 3 {
+			return PHASE_PATCHING
+		}
+	case TIMEFRAME_INDEXING_KEY:
+		if steps == 0 {
+			return PHASE_INDEXING
+		}
+	case STATE_ROLLBACK_KEY:
+		return PHASE_ROLLING_BACK
+	case CSV_BUILDING_KEY:
+		switch steps {
+		case 0:
+			return PHASE_WRITING
+		case 1:
+			return PHASE_ZIPPING
+		}
+	}
+	return PHASE_DONE
+}
+
+func GetRunnerStatus(r *gorunner.Runner) RunnerStatus {
+	d := newJobDescriptor(r)
+	status := RunnerStatus{
+		ID:         r.ID,
+		Kind:       d.Kind,
+		Phase:      runnerPhase(r),
+		Addresses:  d.Addresses,
+		Timeframes: []int64{},
+		Percent:    r.Percent(),
+		ETA:        r.ETA().Milliseconds(),
+		Elapsed:    r.Timer().Milliseconds(),
+		Rows:       r.StatValue(STAT_VALUE_DATA_COUNT) + r.StatValue(STAT_VALUE_LINE_COUNT),
+		Bytes:      r.StatValue(STAT_VALUE_ARCHIVE_SIZE),
+		Retries:    r.RetryCount(),
+	}
+	if err := r.GetError(); err != nil {
+		status.Error = err.Error()
+	}
+	timeframes := d.Timeframes
+	if len(timeframes) == 0 && d.Timeframe > 0 {
+		timeframes = []time.Duration{d.Timeframe}
+	}
+	for _, tf := range timeframes {
+		status.Timeframes = append(status.Timeframes, tf.Milliseconds())
+	}
+
+	switch status.Kind {
+	case STATE_PARSING_KEY, DAY_REPARSING_KEY, STATE_ROLLBACK_KEY:
+		status.Date = d.Date
+		if status.Kind != STATE_ROLLBACK_KEY {
+			status.Throughput = r.SizePerMillisecond() * 1000
+			status.ThroughputUnit = THROUGHPUT_UNIT_LINES
+		}
+	case TIMEFRAME_INDEXING_KEY, CSV_BUILDING_KEY:
+		if current := r.Size().Current(); current > 0 {
+			status.CurrentDate = pcommon.Format.FormatDateStr(pcommon.NewTimeUnit(current).ToTime())
+		}
+		status.Throughput = r.SizePerMillisecond() * 1000 * float64(pcommon.TIME_UNIT_DURATION) / float64(time.Millisecond)
+		status.ThroughputUnit = THROUGHPUT_UNIT_DATA_TIME
+	}
+	return status
+}
+
+// the number of finished runners listed after the running ones
+const RECENT_RUNNER_STATUSES = 10
+
+// recordStatus returns the status of a runner done or failed for good, from its record in the history.
+func recordStatus(record JobRecord) RunnerStatus {
+	status := RunnerStatus{
+		ID:         record.ID,
+		Kind:       record.Kind,
+		Phase:      PHASE_DONE,
+		Addresses:  record.Addresses,
+		Timeframes: record.Timeframes,
+		Date:       record.Date,
+		Percent:    100,
+		Elapsed:    record.Duration,
+		Rows:       record.Rows,
+		Retries:    record.Retries,
+		Error:      record.Error,
+	}
+	if record.Outcome == JOB_OUTCOME_FAILED {
+		status.Phase = PHASE_FAILED
+		status.Percent = 0
+	}
+	return status
+}
+
+// GetRunnerStatuses returns the status of the running runners, then of the last runners done or failed for good, the most recent first.
+func (e *engine) GetRunnerStatuses() []RunnerStatus {
+	list := []RunnerStatus{}
+	for _, j := range e.queue.list() {
+		if j.runner.IsRunning() {
+			list = append(list, GetRunnerStatus(j.runner))
+		}
+	}
+	finished := 0
+	for _, record := range e.JobHistory(JobHistoryFilter{}) {
+		if finished == RECENT_RUNNER_STATUSES {
+			break
+		}
+		if record.Outcome == JOB_OUTCOME_CANCELLED {
+			continue
+		}
+		list = append(list, recordStatus(record))
+		finished++
+	}
+	return list
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+/*
+The runners are handed to the runner engine by priority, the highest first.
+Among the runners of the same priority, the sets with the fewest runners in the engine are served first, then the ones served the longest ago,
+so a large backfill of a set doesn't starve the others.
+*/
+
+type Priority int
+
+const (
+	PRIORITY_CLASS_EXPORT   = "export"
+	PRIORITY_CLASS_ROLLBACK = "rollback"
+	PRIORITY_CLASS_INDEXING = "indexing"
+	PRIORITY_CLASS_PARSING  = "parsing"
+)
+
+// JOB_PRIORITIES_ENV overrides the priority of the classes, e.g. "export=30,rollback=20,indexing=10,parsing=0"
+const JOB_PRIORITIES_ENV = "JOB_PRIORITIES"
+
+// MAX_RUNNING_JOBS_PER_SET_ENV limits the runners of a set in the engine at once, 0 for no limit.
+const MAX_RUNNING_JOBS_PER_SET_ENV = "MAX_RUNNING_JOBS_PER_SET"
+
+const ARG_VALUE_PRIORITY = "priority"
+
+var PRIORITY_CLASSES = map[string]Priority{
+	PRIORITY_CLASS_EXPORT:   30,
+	PRIORITY_CLASS_ROLLBACK: 20,
+	PRIORITY_CLASS_INDEXING: 10,
+	PRIORITY_CLASS_PARSING:  0,
+}
+
+var maxRunningJobsPerSet = 0
+
+func initScheduler() error {
+	if env := os.Getenv(JOB_PRIORITIES_ENV); env != "" {
+		for _, entry := range strings.Split(env, ",") {
+			class, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if _, known := PRIORITY_CLASSES[class]; !ok || !known {
+				return fmt.Errorf("%s: invalid entry %q", JOB_PRIORITIES_ENV, entry)
+			}
+			p, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: invalid priority %q", JOB_PRIORITIES_ENV, value)
+			}
+			PRIORITY_CLASSES[class] = Priority(p)
+		}
+	}
+	if env := os.Getenv(MAX_RUNNING_JOBS_PER_SET_ENV); env != "" {
+		max, err := strconv.Atoi(env)
+		if err != nil || max < 0 {
+			return fmt.Errorf("%s: invalid value %q", MAX_RUNNING_JOBS_PER_SET_ENV, env)
+		}
+		maxRunningJobsPerSet = max
+	}
+	return nil
+}
+
+// priorityClass returns the class of a runner: exports, rollbacks, indexing of timeframes and computed assets, parsing of archives.
+func priorityClass(r *gorunner.Runner) string {
+	switch runnerKind(r) {
+	case CSV_BUILDING_KEY:
+		return PRIORITY_CLASS_EXPORT
+	case STATE_ROLLBACK_KEY:
+		return PRIORITY_CLASS_ROLLBACK
+	case TIMEFRAME_INDEXING_KEY:
+		return PRIORITY_CLASS_INDEXING
+	}
+	return PRIORITY_CLASS_PARSING
+}
+
+// setPriority overrides the priority of the class of a runner, if priority is not nil.
+func setPriority(r *gorunner.Runner, priority *Priority) {
+	if priority != nil {
+		r.Args[ARG_VALUE_PRIORITY] = *priority
+	}
+}
+
+func getPriority(r *gorunner.Runner) Priority {
+	if p, ok := gorunner.GetArg[Priority](r.Args, ARG_VALUE_PRIORITY); ok {
+		return p
+	}
+	return PRIORITY_CLASSES[priorityClass(r)]
+}
+
+/*
+next returns the next job to hand to the runner engine and marks it as dispatched,
+nil if there is none or if the governor holds it back until memory is freed.
+The jobs of the classes held by the disk watchdog are skipped.
+*/
+func (q *jobQueue) next(governor *resourceGovernor, watchdog *diskWatchdog) *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	inEngine := map[string]int{}
+	dispatched := []*job{}
+	for _, j := range q.jobs {
+		if j.dispatched {
+			inEngine[j.setID]++
+			dispatched = append(dispatched, j)
+		}
+	}
+
+	var best *job
+	better := func(j *job) bool {
+		if j.priority != best.priority {
+			return j.priority > best.priority
+		}
+		if inEngine[j.setID] != inEngine[best.setID] {
+			return inEngine[j.setID] < inEngine[best.setID]
+		}
+		if q.lastDispatch[j.setID] != q.lastDispatch[best.setID] {
+			return q.lastDispatch[j.setID] < q.lastDispatch[best.setID]
+		}
+		return j.descriptor.Sequence < best.descriptor.Sequence
+	}
+	for _, j := range q.jobs {
+		if j.dispatched || j.descriptor.Paused || j.suspended || j.resuming || !watchdog.admits(j.runner) {
+			continue
+		}
+		if maxRunningJobsPerSet > 0 && inEngine[j.setID] >= maxRunningJobsPerSet {
+			continue
+		}
+		if best == nil || better(j) {
+			best = j
+		}
+	}
+
+	//the jobs of lower priority wait as well, so the job held back is the next one once memory is freed
+	if best != nil && !governor.admit(best, dispatched) {
+		return nil
+	}
+	if best != nil {
+		best.dispatched = true
+		q.dispatches++
+		q.lastDispatch[best.setID] = q.dispatches
+	}
+	return best
+}
+
+/*
+dispatch hands the next jobs to the runner engine while it has room for them and the governor admits them.
+A few runners are kept waiting in the engine, so the ones held by their running filter don't leave slots unused.
+*/
+func (e *engine) dispatch() {
+	e.dispatchMu.Lock()
+	defer e.dispatchMu.Unlock()
+
+	e.governor.sample()
+	for e.Engine.CountQueued() < pcommon.Env.MAX_SIMULTANEOUS_PARSING {
+		j := e.queue.next(e.governor, e.watchdog)
+		if j == nil {
+			return
+		}
+		runnerLog(j.runner).WithField("priority", j.priority).Debug("Job dispatched")
+		e.Engine.Add(j.runner)
+	}
+}
+
+// CountQueued returns the number of runners waiting, in the queue or in the runner engine.
+func (e *engine) CountQueued() int {
+	return e.queue.count() - e.CountRunning()
+}
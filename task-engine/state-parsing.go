@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"pendulev2/metrics"
 	setlib "pendulev2/set2"
+	"pendulev2/util"
 	"strconv"
 	"strings"
 	"time"
@@ -29,21 +31,21 @@ func printStateParsingStatus(runner *gorunner.Runner, asset *setlib.AssetState)
 		if runner.CountSteps() == 0 {
 			archiveSize := runner.StatValue(STAT_VALUE_ARCHIVE_SIZE)
 
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"size": pcommon.Format.LargeBytesToShortString(archiveSize),
 			}).Info(fmt.Sprintf("Unzipping %s archive (%s)", id, date))
 			return
 		} else if runner.CountSteps() == 1 {
 			archiveSize := runner.StatValue(STAT_VALUE_ARCHIVE_SIZE)
 
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"size": pcommon.Format.LargeBytesToShortString(int64(float64(archiveSize) * 5.133)),
 			}).Info(fmt.Sprintf("Parsing %s (%s)", id, date))
 
 		} else if runner.CountSteps() == 2 {
 			tradeParsed := pcommon.Format.LargeNumberToShortString(runner.Size().Current()) + "/" + pcommon.Format.LargeNumberToShortString(runner.Size().Max())
 
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"progress": fmt.Sprintf("%.2f%%", runner.Percent()),
 				"speed":    pcommon.Format.LargeNumberToShortString(int64(runner.SizePerMillisecond()*1000)) + " line/s",
 				"total":    tradeParsed,
@@ -51,7 +53,7 @@ func printStateParsingStatus(runner *gorunner.Runner, asset *setlib.AssetState)
 			}).Info(fmt.Sprintf("Building %s (%s)", id, date))
 		} else if runner.CountSteps() == 3 {
 			totalRows := runner.StatValue(STAT_VALUE_DATA_COUNT)
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"aggregated": pcommon.Format.LargeNumberToShortString(totalRows),
 				"parsed":     pcommon.Format.LargeNumberToShortString(runner.Size().Max()),
 			}).Info(fmt.Sprintf("Storing %s (%s)", id, date))
@@ -59,7 +61,7 @@ func printStateParsingStatus(runner *gorunner.Runner, asset *setlib.AssetState)
 		} else if runner.CountSteps() >= 4 {
 			totalRows := runner.StatValue(STAT_VALUE_DATA_COUNT)
 
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"aggregated": pcommon.Format.LargeNumberToShortString(totalRows),
 				"parsed":     pcommon.Format.LargeNumberToShortString(runner.Size().Max()),
 				"done":       "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
@@ -96,24 +98,6 @@ func addStateParsingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetSt
 			return err
 		}
 
-		archiveFilePathCSV := asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "csv")
-		archiveFilePathZIP := asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "zip")
-
-		archiveFolderPath := asset.SetRef.Settings.BuildArchiveFolderPath(asset.Type())
-
-		defer func() {
-			if os.Remove(archiveFilePathCSV) == nil {
-				runner.SetStatValue("CSV_FILE_REMOVED", 1)
-			}
-		}()
-
-		archiveZipSize, err := pcommon.File.GetFileSize(archiveFilePathZIP)
-		if err != nil {
-			return err
-		}
-
-		runner.SetStatValue(STAT_VALUE_ARCHIVE_SIZE, archiveZipSize)
-
 		go func() {
 			time.Sleep(2 * time.Second)
 			for runner.IsRunning() {
@@ -122,30 +106,13 @@ func addStateParsingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetSt
 			}
 		}()
 
-		err = pcommon.File.UnzipFile(archiveFilePathZIP, archiveFolderPath)
+		dataList, record, err := parseArchiveDay(runner, asset, date)
 		if err != nil {
-			if err.Error() == "zip: not a valid zip file" {
-				os.Remove(archiveFilePathZIP)
-			}
 			return err
 		}
-
-		runner.AddStep()
-		csvLines, err := parseFromCSV(asset, date)
-		if err != nil {
+		if err := ensureSetPrices([]*setlib.AssetState{asset}, []pcommon.DataList{dataList}); err != nil {
 			return err
 		}
-		if len(csvLines) == 0 {
-			log.WithFields(log.Fields{
-				"set":   asset.SetRef.ID(),
-				"asset": asset.Address(),
-				"date":  date,
-			}).Warn("No data found in CSV file")
-		}
-
-		runner.SetSize().Max(int64(len(csvLines)))
-		runner.AddStep()
-		dataList := aggregateLinesToValuesToPrices(csvLines, asset)
 		for _, tick := range dataList.Map() {
 			prevState.CheckUpdateMax(tick.Max(), tick.GetTime())
 			prevState.CheckUpdateMin(tick.Min(), tick.GetTime())
@@ -153,9 +120,15 @@ func addStateParsingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetSt
 
 		runner.SetStatValue(STAT_VALUE_DATA_COUNT, int64(dataList.Len()))
 		runner.AddStep()
+		if runner.MustInterrupt() {
+			return nil
+		}
 		if err := asset.Store(dataList.ToRaw(asset.Decimals()), timeframe, prevState.Copy(), pcommon.NewTimeUnitFromTime(dateTime).Add(time.Hour*24)); err != nil {
 			return err
 		}
+		if err := asset.StoreIngestionRecord(*record); err != nil {
+			return err
+		}
 
 		runner.AddStep()
 		printStateParsingStatus(runner, asset)
@@ -164,6 +137,94 @@ func addStateParsingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetSt
 	runner.AddProcess(process)
 }
 
+/*
+parseArchiveDay unzips and parses the archive of the given date, and aggregates its lines on the minimum timeframe.
+It returns the aggregated rows and the ingestion record describing them.
+The runner steps are incremented once the archive is unzipped and once the CSV is parsed.
+*/
+func parseArchiveDay(runner *gorunner.Runner, asset *setlib.AssetState, date string) (pcommon.DataList, *setlib.IngestionRecord, error) {
+	archiveFilePathCSV := asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "csv")
+	archiveFilePathZIP := asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "zip")
+
+	archiveFolderPath := asset.SetRef.Settings.BuildArchiveFolderPath(asset.Type())
+
+	defer func() {
+		if os.Remove(archiveFilePathCSV) == nil {
+			runner.SetStatValue("CSV_FILE_REMOVED", 1)
+		}
+	}()
+
+	archiveZipSize, err := pcommon.File.GetFileSize(archiveFilePathZIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runner.SetStatValue(STAT_VALUE_ARCHIVE_SIZE, archiveZipSize)
+
+	checksum, err := util.FileSha256(archiveFilePathZIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = pcommon.File.UnzipFile(archiveFilePathZIP, archiveFolderPath)
+	if err != nil {
+		//a corrupted archive is removed so it can be downloaded again, the failure counting against the day
+		if err.Error() == "zip: not a valid zip file" && os.Remove(archiveFilePathZIP) == nil {
+			runnerLog(runner).Warn("Corrupted archive removed")
+			return nil, nil, fmt.Errorf("corrupted archive removed: %w", err)
+		}
+		return nil, nil, err
+	}
+
+	runner.AddStep()
+	csvLines, err := parseFromCSV(asset, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	metrics.TicksParsed.WithLabelValues(asset.SetRef.ID(), string(asset.Type())).Add(float64(len(csvLines)))
+	if len(csvLines) == 0 {
+		runnerLog(runner).Warn("No data found in CSV file")
+	}
+
+	runner.SetSize().Max(int64(len(csvLines)))
+	runner.AddStep()
+	dataList := aggregateLinesToValuesToPrices(csvLines, asset)
+
+	record := &setlib.IngestionRecord{
+		Date:      date,
+		LineCount: int64(len(csvLines)),
+		RowCount:  int64(dataList.Len()),
+		Checksum:  checksum,
+		ParsedAt:  pcommon.NewTimeUnitFromTime(time.Now()),
+	}
+	if dataList.Len() > 0 {
+		record.MinTime = dataList.First().GetTime()
+		record.MaxTime = dataList.Last().GetTime()
+	}
+
+	return dataList, record, nil
+}
+
+/*
+ensureSetPrices bootstraps the prices of the set from the parsed rows of a price asset if they are unknown,
+the decimals of the stored data depending on them. An error is returned if the prices are still unknown.
+*/
+func ensureSetPrices(assets []*setlib.AssetState, lists []pcommon.DataList) error {
+	set := assets[0].SetRef
+	if set.HasPrices() {
+		return nil
+	}
+	for i, asset := range assets {
+		if !setlib.IsPriceAsset(asset.Type()) || len(asset.ParsedAddress().Arguments) > 0 || lists[i].Len() == 0 {
+			continue
+		}
+		if unit, ok := unpointerData(lists[i].Last()).(pcommon.UnitTime); ok && unit.Close > 0 {
+			return set.BootstrapPrices(unit.Close)
+		}
+	}
+	return fmt.Errorf("%w for %s: a price asset must be parsed first or the prices set in the settings", setlib.ErrPricesUnknown, set.ID())
+}
+
 type CSVLine struct {
 	Timestamp pcommon.TimeUnit
 	Value     float64
@@ -187,7 +248,11 @@ func parseFromCSVLine(fields []string) (CSVLine, error) {
 }
 
 func parseFromCSV(asset *setlib.AssetState, date string) ([]CSVLine, error) {
-	file, err := os.Open(asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "csv"))
+	return parseFromCSVFile(asset.SetRef.Settings.BuildArchiveFilePath(asset.Type(), date, "csv"))
+}
+
+func parseFromCSVFile(path string) ([]CSVLine, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
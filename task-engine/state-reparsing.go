@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	setlib "pendulev2/set2"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DAY_REPARSING_KEY = "day_reparsing"
+)
+
+func isDayReparsingRunner(r *gorunner.Runner) bool {
+	return strings.HasPrefix(r.ID, DAY_REPARSING_KEY)
+}
+
+func printDayReparsingStatus(runner *gorunner.Runner, asset *setlib.AssetState) {
+	date := getDate(runner)
+
+	id, _ := asset.ParsedAddress().BuildCSVColumnName(true)
+	if runner.IsRunning() {
+		if runner.CountSteps() < 3 {
+			runnerLog(runner).WithFields(log.Fields{
+				"size": pcommon.Format.LargeBytesToShortString(runner.StatValue(STAT_VALUE_ARCHIVE_SIZE)),
+			}).Info(fmt.Sprintf("Re-parsing %s (%s)", id, date))
+		} else if runner.CountSteps() == 3 {
+			runnerLog(runner).WithFields(log.Fields{
+				"aggregated": pcommon.Format.LargeNumberToShortString(runner.StatValue(STAT_VALUE_DATA_COUNT)),
+				"parsed":     pcommon.Format.LargeNumberToShortString(runner.Size().Max()),
+			}).Info(fmt.Sprintf("Patching %s (%s)", id, date))
+		} else {
+			runnerLog(runner).WithFields(log.Fields{
+				"aggregated": pcommon.Format.LargeNumberToShortString(runner.StatValue(STAT_VALUE_DATA_COUNT)),
+				"parsed":     pcommon.Format.LargeNumberToShortString(runner.Size().Max()),
+				"done":       "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
+			}).Info(fmt.Sprintf("Successfully re-parsed %s (%s)", id, date))
+		}
+	}
+}
+
+/*
+reindexTimeframeRange rebuilds the candles of the given timeframe containing at least one tick between t0 (included) and t1 (excluded).
+Only the candles already indexed are rebuilt, the next ones will be built by the timeframe indexing.
+*/
+func reindexTimeframeRange(asset *setlib.AssetState, timeframe time.Duration, t0, t1 pcommon.TimeUnit) error {
+	lastIndexed, err := asset.GetLastTimeframeIndexingDate(timeframe)
+	if err != nil {
+		return err
+	}
+	if lastIndexed == 0 {
+		return nil
+	}
+
+	alignment := asset.TimeframeAlignment(timeframe)
+	//first candle ending after t0
+	candleEnd := alignment.CandleEnd(t0)
+
+	txn := asset.NewTX(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+
+	patchStart := candleEnd
+	batch := make(map[pcommon.TimeUnit][]byte)
+	for ; alignment.CandleStart(candleEnd) < t1 && candleEnd <= lastIndexed; candleEnd = alignment.Next(candleEnd) {
+		ticks, err := asset.GetInDataRange(alignment.CandleStart(candleEnd), candleEnd, pcommon.Env.MIN_TIME_FRAME, txn, iter, false)
+		if err != nil {
+			return err
+		}
+		if ticks.Len() > 0 {
+			batch[candleEnd] = ticks.Aggregate(timeframe, candleEnd).ToRaw(asset.Decimals())
+		}
+	}
+	if candleEnd == patchStart {
+		return nil
+	}
+
+	return asset.Patch(batch, timeframe, patchStart, candleEnd)
+}
+
+func addDayReparsingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetState) {
+	process := func() error {
+		date := getDate(runner)
+
+		dateTime, err := pcommon.Format.StrDateToDate(date)
+		if err != nil {
+			return err
+		}
+		t0 := pcommon.NewTimeUnitFromTime(dateTime)
+		t1 := t0.Add(time.Hour * 24)
+
+		consistencyTime, err := asset.GetLastConsistencyTimeCached(pcommon.Env.MIN_TIME_FRAME)
+		if err != nil {
+			return err
+		}
+		if t1 > consistencyTime {
+			return errors.New("date has not been parsed yet")
+		}
+
+		go func() {
+			time.Sleep(2 * time.Second)
+			for runner.IsRunning() {
+				printDayReparsingStatus(runner, asset)
+				time.Sleep(5 * time.Second)
+			}
+		}()
+
+		dataList, record, err := parseDay(runner, asset, date)
+		if err != nil {
+			return err
+		}
+
+		runner.SetStatValue(STAT_VALUE_DATA_COUNT, int64(dataList.Len()))
+		runner.AddStep()
+		if runner.MustInterrupt() {
+			return nil
+		}
+		if err := asset.Patch(dataList.ToRaw(asset.Decimals()), pcommon.Env.MIN_TIME_FRAME, t0, t1); err != nil {
+			return err
+		}
+		if err := asset.StoreIngestionRecord(*record); err != nil {
+			return err
+		}
+
+		if asset.IsUnit() || asset.IsQuantity() {
+			for _, timeframe := range asset.GetActiveTimeFrameList() {
+				if timeframe <= pcommon.Env.MIN_TIME_FRAME {
+					continue
+				}
+				if err := reindexTimeframeRange(asset, timeframe, t0, t1); err != nil {
+					return err
+				}
+			}
+		}
+
+		runner.AddStep()
+		printDayReparsingStatus(runner, asset)
+		return nil
+	}
+	runner.AddProcess(process)
+}
+
+/*
+buildDayReparsingRunner re-parses the archive of an already parsed day and replaces its rows, without moving the consistency time.
+The candles of the higher timeframes containing the day are rebuilt, the assets depending on this one are not recomputed.
+*/
+func buildDayReparsingRunner(state *setlib.AssetState, date string) *gorunner.Runner {
+	runner := gorunner.NewRunner(DAY_REPARSING_KEY + "-" + string(state.Address()) + "-" + date)
+
+	addTimeframe(runner, pcommon.Env.MIN_TIME_FRAME)
+	addDate(runner, date)
+	addAssetAddresses(runner, []pcommon.AssetAddress{state.Address()})
+
+	runner.AddRunningFilter(func(details gorunner.EngineDetails, runner *gorunner.Runner) bool {
+		for _, r := range details.RunningRunners {
+			if haveSameAddresses(r, runner) {
+				return false
+			}
+		}
+		return true
+	})
+
+	addDayReparsingRunnerProcess(runner, state)
+	return runner
+}
@@ -24,18 +24,16 @@ func buildStateRollbackRunner(state *setlib.AssetState, date string, timeframe t
 
 	runner.AddProcess(func() error {
 		err := state.RollbackData(date, timeframe, func(percent float64) {
-			log.WithFields(log.Fields{
-				"timeframe": label,
-				"progress":  fmt.Sprintf("%.2f", percent) + "%",
+			runnerLog(runner).WithFields(log.Fields{
+				"progress": fmt.Sprintf("%.2f", percent) + "%",
 			}).Info(fmt.Sprintf("Rollingback %s to %s", state.ParsedAddress().PrettyString(), date+" 00:00:00"))
 		})
 		if err != nil {
 			return err
 		}
 
-		log.WithFields(log.Fields{
-			"timeframe": label,
-			"done":      "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
+		runnerLog(runner).WithFields(log.Fields{
+			"done": "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
 		}).Info(fmt.Sprintf("Rolledback %s to %s", state.ParsedAddress().PrettyString(), date+" 00:00:00"))
 		return nil
 	})
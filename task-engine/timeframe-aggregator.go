@@ -0,0 +1,184 @@
+package engine
+
+import (
+	setlib "pendulev2/set2"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/fantasim/gorunner"
+	pcommon "github.com/pendulea/pendule-common"
+)
+
+/*
+timeframeAggregator builds the candles of a timeframe from the ticks of a smaller timeframe pushed in chronological order.
+The candles are stored once per day along with the prev state and the consistency of the timeframe.
+*/
+type timeframeAggregator struct {
+	runner    *gorunner.Runner
+	asset     *setlib.AssetState
+	timeframe time.Duration
+	alignment setlib.TimeframeAlignment
+
+	prevState *setlib.PrevState
+	t0, t1    pcommon.TimeUnit //range of the current candle
+	ticks     pcommon.DataList //ticks of the current candle
+	batch     map[pcommon.TimeUnit][]byte
+}
+
+func newTimeframeAggregator(runner *gorunner.Runner, asset *setlib.AssetState, timeframe time.Duration) (*timeframeAggregator, error) {
+	if err := asset.AddIfUnfoundInReadList(timeframe); err != nil {
+		return nil, err
+	}
+
+	prevState, err := asset.GetLastPrevStateCached(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	prevT1, err := asset.GetLastTimeframeIndexingDate(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := &timeframeAggregator{
+		runner:    runner,
+		asset:     asset,
+		timeframe: timeframe,
+		alignment: asset.TimeframeAlignment(timeframe),
+		prevState: prevState,
+		ticks:     pcommon.NewTypeTimeArray(asset.DataType()),
+		batch:     make(map[pcommon.TimeUnit][]byte),
+	}
+	if prevT1 == 0 {
+		agg.t0, agg.t1 = agg.alignment.FirstCandle(asset.DataHistoryTime0())
+	} else {
+		agg.t0 = prevT1
+		agg.t1 = agg.alignment.Next(prevT1)
+	}
+	return agg, nil
+}
+
+// push adds a tick starting at tickTime to the current candle, after closing the candles ending before it.
+func (agg *timeframeAggregator) push(tick pcommon.Data, tickTime pcommon.TimeUnit) error {
+	if tickTime < agg.t0 {
+		return nil
+	}
+	for tickTime >= agg.t1 {
+		if err := agg.close(); err != nil {
+			return err
+		}
+	}
+	agg.ticks = agg.ticks.Append(tick)
+	return nil
+}
+
+// close aggregates the ticks of the current candle and moves to the next one, the batch is stored when the day changes.
+func (agg *timeframeAggregator) close() error {
+	if agg.ticks.Len() > 0 {
+		aggregatedTick := agg.ticks.Aggregate(agg.timeframe, agg.t1)
+		agg.prevState.CheckUpdateMin(aggregatedTick.Min(), agg.t1)
+		agg.prevState.CheckUpdateMax(aggregatedTick.Max(), agg.t1)
+		agg.batch[agg.t1] = aggregatedTick.ToRaw(agg.asset.Decimals())
+		agg.runner.IncrementStatValue(STAT_VALUE_DATA_COUNT, 1)
+		agg.ticks = pcommon.NewTypeTimeArray(agg.asset.DataType())
+	}
+
+	next := agg.alignment.Next(agg.t1)
+	if pcommon.Format.FormatDateStr(agg.t1.ToTime()) != pcommon.Format.FormatDateStr(next.ToTime()) {
+		if err := agg.asset.Store(agg.batch, agg.timeframe, agg.prevState.Copy(), agg.t1); err != nil {
+			return err
+		}
+		agg.batch = make(map[pcommon.TimeUnit][]byte)
+	}
+
+	agg.t0 = agg.t1
+	agg.t1 = next
+	return nil
+}
+
+// flush closes the candles ending before scannedTime, all their ticks having been pushed, and stores the remaining batch.
+func (agg *timeframeAggregator) flush(scannedTime pcommon.TimeUnit) error {
+	for agg.t1 <= scannedTime {
+		if err := agg.close(); err != nil {
+			return err
+		}
+	}
+	if len(agg.batch) > 0 {
+		if err := agg.asset.Store(agg.batch, agg.timeframe, agg.prevState.Copy(), agg.t0); err != nil {
+			return err
+		}
+		agg.batch = make(map[pcommon.TimeUnit][]byte)
+	}
+	return nil
+}
+
+/*
+indexTimeframes reads once, day by day, the ticks of the source timeframe from the earliest pending candle until maxTime,
+and feeds every aggregator with them.
+*/
+func indexTimeframes(runner *gorunner.Runner, asset *setlib.AssetState, aggregators []*timeframeAggregator, sourceTimeframe time.Duration, maxTime pcommon.TimeUnit) error {
+	if len(aggregators) == 0 {
+		return nil
+	}
+
+	//the candles of a higher timeframe are stored at their end time, so they are read in (t0, t1] instead of [t0, t1)
+	sourceOffset := time.Duration(0)
+	if sourceTimeframe != pcommon.Env.MIN_TIME_FRAME {
+		sourceOffset = pcommon.TIME_UNIT_DURATION
+	}
+
+	from := aggregators[0].t0
+	for _, agg := range aggregators[1:] {
+		if agg.t0 < from {
+			from = agg.t0
+		}
+	}
+
+	runner.SetSize().Initial(from.Int())
+	runner.SetSize().Max(maxTime.Int())
+
+	//tx
+	txn := asset.NewTX(false)
+	defer txn.Discard()
+
+	//iterator
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	opts.Reverse = false
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+
+	scannedTime := from
+	for scannedTime < maxTime {
+		to := scannedTime.Add(pcommon.DAY)
+		if to > maxTime {
+			to = maxTime
+		}
+
+		ticks, err := asset.GetInDataRange(scannedTime.Add(sourceOffset), to.Add(sourceOffset), sourceTimeframe, txn, iter, false)
+		if err != nil {
+			return err
+		}
+		for _, tick := range ticks.Map() {
+			tickTime := tick.GetTime().Add(-sourceOffset)
+			for _, agg := range aggregators {
+				if err := agg.push(tick, tickTime); err != nil {
+					return err
+				}
+			}
+		}
+
+		scannedTime = to
+		runner.SetSize().Current(scannedTime.Int(), false)
+		if runner.MustInterrupt() {
+			break
+		}
+	}
+
+	for _, agg := range aggregators {
+		if err := agg.flush(scannedTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,9 +3,9 @@ package engine
 import (
 	"fmt"
 	setlib "pendulev2/set2"
+	"strings"
 	"time"
 
-	badger "github.com/dgraph-io/badger/v4"
 	"github.com/fantasim/gorunner"
 	pcommon "github.com/pendulea/pendule-common"
 	log "github.com/sirupsen/logrus"
@@ -30,16 +30,16 @@ func printTimeframeIndexingStatus(runner *gorunner.Runner, state *setlib.AssetSt
 		if runner.CountSteps() == 0 {
 			date := pcommon.NewTimeUnit(runner.Size().Current()).ToTime()
 
-			log.WithFields(log.Fields{
-				"progress": fmt.Sprintf("%.2f%%", runner.Percent()),
-				"speed":    pcommon.Format.AccurateHumanize(pcommon.TIME_UNIT_DURATION*time.Duration(runner.SizePerMillisecond()*1000)) + " indexed/s",
-				"rows":     pcommon.Format.LargeNumberToShortString(PARSED_ROWS_COUNT),
-				"date":     pcommon.Format.FormatDateStr(date),
-				"eta":      pcommon.Format.AccurateHumanize(runner.ETA()),
+			runnerLog(runner).WithFields(log.Fields{
+				"progress":     fmt.Sprintf("%.2f%%", runner.Percent()),
+				"speed":        pcommon.Format.AccurateHumanize(pcommon.TIME_UNIT_DURATION*time.Duration(runner.SizePerMillisecond()*1000)) + " indexed/s",
+				"rows":         pcommon.Format.LargeNumberToShortString(PARSED_ROWS_COUNT),
+				"current_date": pcommon.Format.FormatDateStr(date),
+				"eta":          pcommon.Format.AccurateHumanize(runner.ETA()),
 			}).Info(fmt.Sprintf("Indexing new %s rows on timeframe: %s", id, label))
 
 		} else if runner.CountSteps() == 1 && PARSED_ROWS_COUNT > 0 {
-			log.WithFields(log.Fields{
+			runnerLog(runner).WithFields(log.Fields{
 				"rows": pcommon.Format.LargeNumberToShortString(PARSED_ROWS_COUNT),
 				"done": "+" + pcommon.Format.AccurateHumanize(runner.Timer()),
 			}).Info(fmt.Sprintf("Successfully stored %s rows on timeframe: %s ", id, label))
@@ -71,7 +71,19 @@ func addTimeframeIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 			return err
 		}
 
-		if err := asset.AddIfUnfoundInReadList(timeframe); err != nil {
+		sourceTimeframe, err := asset.GetTimeframeSource(timeframe)
+		if err != nil {
+			return err
+		}
+		if sourceTimeframe != pcommon.Env.MIN_TIME_FRAME {
+			maxTime, err = asset.GetLastTimeframeIndexingDate(sourceTimeframe)
+			if err != nil {
+				return err
+			}
+		}
+
+		agg, err := newTimeframeAggregator(runner, asset, timeframe)
+		if err != nil {
 			return err
 		}
 
@@ -82,79 +94,63 @@ func addTimeframeIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 			}
 		}()
 
-		prevState, err := asset.GetLastPrevStateCached(timeframe)
-		if err != nil {
+		if err := indexTimeframes(runner, asset, []*timeframeAggregator{agg}, sourceTimeframe, maxTime); err != nil {
 			return err
 		}
 
-		prevT1, err := asset.GetLastTimeframeIndexingDate(timeframe)
-		if err != nil {
-			return err
-		}
-		var t0, t1 pcommon.TimeUnit
-		if prevT1 == 0 {
-			t0Time, t1Time := buildInitialCandleRange(asset.DataHistoryTime0().ToTime(), timeframe)
-			t0 = pcommon.NewTimeUnitFromTime(t0Time)
-			t1 = pcommon.NewTimeUnitFromTime(t1Time)
-		} else {
-			t0 = prevT1
-			t1 = t0.Add(timeframe)
-		}
+		runner.AddStep()
+		printTimeframeIndexingStatus(runner, asset)
+		return nil
+	}
 
-		runner.SetSize().Initial(t0.Int())
-		runner.SetSize().Max(maxTime.Int())
+	runner.AddProcess(process)
+}
 
-		batch := make(map[pcommon.TimeUnit][]byte)
-		currentReadSize := 0
+/*
+addTimeframesIndexingRunnerProcess indexes all the given timeframes of the asset not up to date
+in a single scan of the minimum timeframe ticks.
+*/
+func addTimeframesIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.AssetState) {
 
-		//tx
-		txn := asset.NewTX(false)
-		defer txn.Discard()
+	process := func() error {
 
-		//iterator
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = true
-		opts.Reverse = false
-		iter := txn.NewIterator(opts)
-		defer iter.Close()
+		if (!asset.IsUnit() && !asset.IsQuantity()) || asset.ParsedAddress().HasDependencies() {
+			return nil
+		}
 
-		for t1 <= maxTime {
-			ticks, err := asset.GetInDataRange(t0, t1, pcommon.Env.MIN_TIME_FRAME, txn, iter, false)
+		aggregators := []*timeframeAggregator{}
+		for _, timeframe := range getTimeframes(runner) {
+			sync, err := asset.IsTimeframeIndexUpToDate(timeframe)
 			if err != nil {
 				return err
 			}
-			size := ticks.Len()
-			currentReadSize += size
-			if size > 0 {
-				aggregatedTick := ticks.Aggregate(timeframe, t1)
-				prevState.CheckUpdateMin(aggregatedTick.Min(), t1)
-				prevState.CheckUpdateMax(aggregatedTick.Max(), t1)
-				batch[t1] = aggregatedTick.ToRaw(asset.Decimals())
-				runner.IncrementStatValue(STAT_VALUE_DATA_COUNT, 1)
+			if sync {
+				continue
 			}
-
-			currentDate := pcommon.Format.FormatDateStr(t1.ToTime())
-			nextDate := pcommon.Format.FormatDateStr(t1.Add(timeframe).ToTime())
-
-			if currentDate != nextDate {
-				if err := asset.Store(batch, timeframe, prevState.Copy(), t1); err != nil {
-					return err
-				}
-				batch = make(map[pcommon.TimeUnit][]byte)
+			agg, err := newTimeframeAggregator(runner, asset, timeframe)
+			if err != nil {
+				return err
 			}
+			aggregators = append(aggregators, agg)
+		}
+		if len(aggregators) == 0 {
+			return nil
+		}
 
-			t0 = t1
-			t1 = t1.Add(timeframe)
-			runner.SetSize().Current(t0.Int(), false)
-			if runner.MustInterrupt() {
-				break
-			}
+		maxTime, err := asset.GetLastConsistencyTimeCached(pcommon.Env.MIN_TIME_FRAME)
+		if err != nil {
+			return err
 		}
 
-		if len(batch) > 0 {
-			if err := asset.Store(batch, timeframe, prevState.Copy(), t0); err != nil {
-				return err
+		go func() {
+			for runner.Task.IsRunning() {
+				time.Sleep(5 * time.Second)
+				printTimeframeIndexingStatus(runner, asset)
 			}
+		}()
+
+		if err := indexTimeframes(runner, asset, aggregators, pcommon.Env.MIN_TIME_FRAME, maxTime); err != nil {
+			return err
 		}
 
 		runner.AddStep()
@@ -165,6 +161,25 @@ func addTimeframeIndexingRunnerProcess(runner *gorunner.Runner, asset *setlib.As
 	runner.AddProcess(process)
 }
 
+func isTimeframeIndexingRunner(r *gorunner.Runner) bool {
+	return strings.HasPrefix(r.ID, TIMEFRAME_INDEXING_KEY)
+}
+
+// isTimeframeSourceRunner returns true if r indexes a timeframe of the asset whose candles nest into one of the ones indexed by runner.
+func isTimeframeSourceRunner(asset *setlib.AssetState, r *gorunner.Runner, runner *gorunner.Runner) bool {
+	if !asset.IsComposable() || !isTimeframeIndexingRunner(r) {
+		return false
+	}
+	for _, sourceTimeframe := range getTimeframes(r) {
+		for _, timeframe := range getTimeframes(runner) {
+			if asset.TimeframeAlignment(sourceTimeframe).Divides(asset.TimeframeAlignment(timeframe)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func buildTimeframeIndexingRunner(state *setlib.AssetState, timeframe time.Duration) *gorunner.Runner {
 	runner := gorunner.NewRunner(buildTimeFrameIndexingKey(state.Address(), timeframe))
 
@@ -179,7 +194,8 @@ func buildTimeframeIndexingRunner(state *setlib.AssetState, timeframe time.Durat
 				continue
 			}
 
-			if !haveSameTimeframe(r, runner) {
+			//a running indexing of a smaller timeframe can be the source of this one once done
+			if !haveSameTimeframe(r, runner) && !isDayReparsingRunner(r) && !isTimeframeSourceRunner(state, r, runner) {
 				continue
 			}
 
@@ -191,88 +207,35 @@ func buildTimeframeIndexingRunner(state *setlib.AssetState, timeframe time.Durat
 	return runner
 }
 
-func buildInitialCandleRange(earliestCandle time.Time, timeframe time.Duration) (time.Time, time.Time) {
-	nextQuarter := func(t time.Time) time.Time {
-		quarter := int(t.Month()-1) / 3
-		year := t.Year()
-		month := quarter*3 + 1
-		if month > 12 {
-			month = 1
-			year++
-		}
-		return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	}
-
-	nextNMonth := func(t time.Time, n int) time.Time {
-		year := t.Year()
-		month := int(t.Month()) + n
-		if month > 12 {
-			month = month % 12
-			year++
-		}
-		return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	}
-
-	nextNWeek := func(t time.Time, n int) time.Time {
-		offset := int(time.Monday - t.Weekday())
-		if offset <= 0 {
-			offset += 7 // Ensure it's the next week
-		}
-		nextWeekStart := t.AddDate(0, 0, offset)
-		if n > 1 {
-			nextWeekStart = nextWeekStart.AddDate(0, 0, 7*(n-1))
-		}
-		return time.Date(nextWeekStart.Year(), nextWeekStart.Month(), nextWeekStart.Day(), 0, 0, 0, 0, time.UTC)
-	}
-
-	nextNDay := func(t time.Time, n int) time.Time {
-		d1 := t.AddDate(0, 0, n)
-		//midnight of the next day
-		d1 = time.Date(d1.Year(), d1.Month(), d1.Day(), 0, 0, 0, 0, time.UTC)
-		return d1
+// buildTimeframesIndexingRunner indexes several timeframes of an asset at once, timeframes must be sorted in ascending order.
+func buildTimeframesIndexingRunner(state *setlib.AssetState, timeframes []time.Duration) *gorunner.Runner {
+	labels := []string{}
+	for _, timeframe := range timeframes {
+		label, _ := pcommon.Format.TimeFrameToLabel(timeframe)
+		labels = append(labels, label)
 	}
+	runner := gorunner.NewRunner(TIMEFRAME_INDEXING_KEY + "-" + string(state.Address()) + "-" + strings.Join(labels, "-"))
 
-	nextHour := func(t time.Time) time.Time {
-		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
-	}
-
-	nextMinute := func(t time.Time) time.Time {
-		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, time.UTC)
-	}
+	addTimeframe(runner, timeframes[0])
+	addTimeframes(runner, timeframes)
+	addAssetAddresses(runner, []pcommon.AssetAddress{state.Address()})
+	addTimeframesIndexingRunnerProcess(runner, state)
 
-	if timeframe == pcommon.QUARTER {
-		return earliestCandle, nextQuarter(earliestCandle)
-	} else if timeframe%pcommon.MONTH == 0 {
-		return earliestCandle, nextNMonth(earliestCandle, int(timeframe/pcommon.MONTH))
-	} else if timeframe%pcommon.WEEK == 0 {
-		return earliestCandle, nextNWeek(earliestCandle, int(timeframe/pcommon.WEEK))
-	} else if timeframe%pcommon.DAY == 0 {
-		return earliestCandle, nextNDay(earliestCandle, int(timeframe/pcommon.DAY))
-	} else if timeframe%time.Hour == 0 {
-		if timeframe == time.Hour {
-			return earliestCandle, nextHour(earliestCandle)
-		}
-		//if midnight
-		if earliestCandle.Hour() == 0 && earliestCandle.Minute() == 0 && earliestCandle.Second() == 0 {
-			return earliestCandle, earliestCandle.Add(timeframe)
-		}
+	runner.AddRunningFilter(func(details gorunner.EngineDetails, runner *gorunner.Runner) bool {
+		for _, r := range details.RunningRunners {
 
-		t0 := nextNDay(earliestCandle, 1)
-		return t0, t0.Add(timeframe)
+			if !haveSameAddresses(r, runner) {
+				continue
+			}
 
-	} else if timeframe%time.Minute == 0 {
-		if timeframe == time.Minute {
-			return earliestCandle, nextMinute(earliestCandle)
-		}
+			if !haveSameTimeframe(r, runner) && !isDayReparsingRunner(r) && !isTimeframeSourceRunner(state, r, runner) {
+				continue
+			}
 
-		if earliestCandle.Hour() == 0 && earliestCandle.Minute() == 0 && earliestCandle.Second() == 0 {
-			return earliestCandle, earliestCandle.Add(timeframe)
+			return false
 		}
+		return true
+	})
 
-		t0 := nextNDay(earliestCandle, 1)
-		return t0.UTC(), t0.Add(timeframe).UTC()
-	} else {
-
-		return earliestCandle.UTC(), earliestCandle.Add(timeframe).UTC()
-	}
+	return runner
 }
@@ -1,23 +1,54 @@
 package engine
 
 import (
-	"log"
 	"os"
 	"strings"
 	"time"
 
 	setlib "pendulev2/set2"
+	"pendulev2/util"
 
 	"github.com/fantasim/gorunner"
 	pcommon "github.com/pendulea/pendule-common"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	ARG_VALUE_DATE      = "date"
 	ARG_VALUE_ADDRESSES = "addresses"
 	ARG_VALUE_TIMEFRAME = "timeframe"
+	//set on runners handling several timeframes at once, along with the smallest of them as timeframe
+	ARG_VALUE_TIMEFRAMES = "timeframes"
 )
 
+// runnerLog returns a logger with the context of a runner: its ID, and the set, assets, timeframes and date it works on.
+func runnerLog(r *gorunner.Runner) *log.Entry {
+	fields := log.Fields{util.LOG_FIELD_RUNNER: r.ID}
+	if addresses, ok := gorunner.GetArg[[]pcommon.AssetAddress](r.Args, ARG_VALUE_ADDRESSES); ok && len(addresses) > 0 {
+		if parsed, err := addresses[0].Parse(); err == nil {
+			fields[util.LOG_FIELD_SET] = parsed.IDString()
+		}
+		if len(addresses) == 1 {
+			fields[util.LOG_FIELD_ASSET] = addresses[0]
+		} else {
+			fields[util.LOG_FIELD_ASSET] = addresses
+		}
+	}
+	labels := []string{}
+	for _, timeframe := range getTimeframes(r) {
+		if label, err := pcommon.Format.TimeFrameToLabel(timeframe); err == nil {
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) > 0 {
+		fields[util.LOG_FIELD_TIMEFRAME] = strings.Join(labels, ",")
+	}
+	if date, ok := gorunner.GetArg[string](r.Args, ARG_VALUE_DATE); ok {
+		fields[util.LOG_FIELD_DATE] = date
+	}
+	return log.WithFields(fields)
+}
+
 func addDate(r *gorunner.Runner, date string) {
 	r.Args[ARG_VALUE_DATE] = date
 }
@@ -26,6 +57,10 @@ func addTimeframe(r *gorunner.Runner, timeframe time.Duration) {
 	r.Args[ARG_VALUE_TIMEFRAME] = timeframe
 }
 
+func addTimeframes(r *gorunner.Runner, timeframes []time.Duration) {
+	r.Args[ARG_VALUE_TIMEFRAMES] = timeframes
+}
+
 func addAssetAddresses(r *gorunner.Runner, addresses []pcommon.AssetAddress) {
 	r.Args[ARG_VALUE_ADDRESSES] = addresses
 }
@@ -66,6 +101,16 @@ func getTimeframe(r *gorunner.Runner) time.Duration {
 	return timeframe
 }
 
+func getTimeframes(r *gorunner.Runner) []time.Duration {
+	if timeframes, ok := gorunner.GetArg[[]time.Duration](r.Args, ARG_VALUE_TIMEFRAMES); ok {
+		return timeframes
+	}
+	if timeframe, ok := gorunner.GetArg[time.Duration](r.Args, ARG_VALUE_TIMEFRAME); ok {
+		return []time.Duration{timeframe}
+	}
+	return nil
+}
+
 func isAddressInRunner(r *gorunner.Runner, address pcommon.AssetAddress) bool {
 	addresses := getAddresses(r)
 	for _, a := range addresses {
@@ -96,14 +141,14 @@ func haveSameAddresses(r1, r2 *gorunner.Runner) bool {
 }
 
 func haveSameTimeframe(r1, r2 *gorunner.Runner) bool {
-	timeframe1, ok := gorunner.GetArg[time.Duration](r1.Args, ARG_VALUE_TIMEFRAME)
-	timeframe2, ok2 := gorunner.GetArg[time.Duration](r2.Args, ARG_VALUE_TIMEFRAME)
-
-	if !ok || !ok2 {
-		return false
+	for _, timeframe1 := range getTimeframes(r1) {
+		for _, timeframe2 := range getTimeframes(r2) {
+			if timeframe1 == timeframe2 {
+				return true
+			}
+		}
 	}
-
-	return timeframe1 == timeframe2
+	return false
 }
 
 func GetCSVList() ([]pcommon.CSVStatus, error) {
@@ -135,44 +180,3 @@ func GetCSVList() ([]pcommon.CSVStatus, error) {
 	}
 	return statuses, nil
 }
-
-func HTMLify(r *gorunner.Runner) *pcommon.StatusHTML {
-	html := pcommon.StatusHTML{}
-	// setID, _ := gorunner.GetArg[string](r.Args, ARG_VALUE_SET_ID)
-
-	if strings.Contains(r.ID, TIMEFRAME_INDEXING_KEY) {
-		timeframe := getTimeframe(r)
-		label, _ := pcommon.Format.TimeFrameToLabel(timeframe)
-		addr := getAddresses(r)[0]
-		p, _ := addr.Parse()
-
-		ETAString := pcommon.Format.AccurateHumanize(r.ETA())
-
-		html.HTML = "<span>Indexing " + "<span style=\"font-weight: 700\">" + label + "</span> " + p.PrettyString() + " (<span style=\"font-weight: 700; color: green;\">" + ETAString + "</span>)" + "</span>"
-		html.AssetID = p.PrettyString()
-	}
-	// if strings.Contains(r.ID, STATE_ROLLBACK_KEY) {
-	// 	timeframe := getTimeframe(r)
-	// 	label, _ := pcommon.Format.TimeFrameToLabel(timeframe)
-	// 	addr := getAddresses(r)[0]
-	// 	date := getDate(r)
-	// 	p, _ := addr.Parse()
-
-	// 	ETAString := pcommon.Format.AccurateHumanize(r.ETA())
-	// 	html.HTML = "<span>Deleting " + "<span style=\"font-weight: 700\">" + label + "</span> " + p.PrettyString() + "  (<span style=\"font-weight: 700; color: green;\">" + ETAString + "</span>)" + "</span>"
-	// 	html.AssetID = p.PrettyString()
-	// }
-	if strings.Contains(r.ID, CSV_BUILDING_KEY) {
-		return nil
-	}
-	if strings.Contains(r.ID, STATE_PARSING_KEY) {
-		timeframe := getTimeframe(r)
-		label, _ := pcommon.Format.TimeFrameToLabel(timeframe)
-		ETAString := pcommon.Format.AccurateHumanize(r.ETA())
-		addr := getAddresses(r)[0]
-		p, _ := addr.Parse()
-		html.HTML = "<span>Indexing " + "<span style=\"font-weight: 700\">" + label + "</span> " + p.PrettyString() + " (<span style=\"font-weight: 700; color: green;\">" + ETAString + "</span>)" + "</span>"
-	}
-
-	return &html
-}
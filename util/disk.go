@@ -0,0 +1,41 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+
+	pcommon "github.com/pendulea/pendule-common"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+type DiskSpace struct {
+	Path  string `json:"path"`
+	Free  uint64 `json:"free"` //available to the process
+	Total uint64 `json:"total"`
+}
+
+// GetDiskSpace returns the space of the filesystem holding path, measured on its nearest existing parent if it doesn't exist yet.
+func GetDiskSpace(path string) (DiskSpace, error) {
+	measured := filepath.Clean(path)
+	for {
+		if _, err := os.Stat(measured); !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(measured)
+		if parent == measured {
+			break
+		}
+		measured = parent
+	}
+
+	usage, err := disk.Usage(measured)
+	if err != nil {
+		return DiskSpace{Path: path}, err
+	}
+	return DiskSpace{Path: path, Free: usage.Free, Total: usage.Total}, nil
+}
+
+// DataDirs returns the directories the process writes to.
+func DataDirs() []string {
+	return []string{pcommon.Env.DATABASES_DIR, os.Getenv("CSV_DIR")}
+}
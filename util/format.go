@@ -3,8 +3,11 @@ package util
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
@@ -153,3 +156,17 @@ func ColumnNamesToStrings(columns []pcommon.ColumnName) []string {
 	}
 	return names
 }
+
+func FileSha256(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
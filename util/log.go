@@ -0,0 +1,110 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	pcommon "github.com/pendulea/pendule-common"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+/*
+The logs are configured by the environment:
+
+	LOG_FORMAT           text (default) or json
+	LOG_LEVEL            debug, info (default), warn, error...
+	LOG_FILE             path of a file the logs are also written to, rotated once it reaches LOG_FILE_MAX_SIZE megabytes (100 by default),
+	                     LOG_FILE_MAX_BACKUPS (5 by default) rotated files being kept at most LOG_FILE_MAX_AGE days (30 by default)
+*/
+
+// The fields of the context of the lines logged by the runners and the RPC handlers.
+const (
+	LOG_FIELD_RUNNER    = "runner"
+	LOG_FIELD_SET       = "set"
+	LOG_FIELD_ASSET     = "asset"
+	LOG_FIELD_TIMEFRAME = "timeframe"
+	LOG_FIELD_DATE      = "date"
+	LOG_FIELD_RPC       = "rpc"
+)
+
+func envInt(name string, def int) (int, error) {
+	env := os.Getenv(name)
+	if env == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(env)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s: invalid value %q", name, env)
+	}
+	return v, nil
+}
+
+func InitLogger() error {
+	level := log.InfoLevel
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		var err error
+		if level, err = log.ParseLevel(env); err != nil {
+			return fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	log.SetLevel(level)
+
+	var output io.Writer = os.Stdout
+	path := os.Getenv("LOG_FILE")
+	if path != "" {
+		maxSize, err := envInt("LOG_FILE_MAX_SIZE", 100)
+		if err != nil {
+			return err
+		}
+		maxBackups, err := envInt("LOG_FILE_MAX_BACKUPS", 5)
+		if err != nil {
+			return err
+		}
+		maxAge, err := envInt("LOG_FILE_MAX_AGE", 30)
+		if err != nil {
+			return err
+		}
+		output = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+			MaxAge:     maxAge,
+		})
+	}
+	log.SetOutput(output)
+
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	case "", "text":
+		log.SetFormatter(&log.TextFormatter{
+			ForceColors:     path == "", //no color codes in the file
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		})
+	default:
+		return fmt.Errorf("LOG_FORMAT: unknown format %q", format)
+	}
+	return nil
+}
+
+// AssetLog returns a logger with the context of an asset: its set and address.
+func AssetLog(address pcommon.AssetAddress) *log.Entry {
+	fields := log.Fields{LOG_FIELD_ASSET: address}
+	if parsed, err := address.Parse(); err == nil {
+		fields[LOG_FIELD_SET] = parsed.IDString()
+	}
+	return log.WithFields(fields)
+}
+
+// RPCLog returns a logger with the context of an RPC call on an asset, address can be empty.
+func RPCLog(method string, address pcommon.AssetAddress) *log.Entry {
+	if address == "" {
+		return log.WithField(LOG_FIELD_RPC, method)
+	}
+	return AssetLog(address).WithField(LOG_FIELD_RPC, method)
+}